@@ -0,0 +1,129 @@
+package command
+
+import (
+	"../model"
+	"../storage"
+	"../utils"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Usage of the apikeys command
+const apiKeysUsage = `usage: apikeys list | create -name name [-scope "products:read products:write"] [-role viewer|editor|admin] [-team name] | disable id | enable id | revoke id`
+
+// APIKeys lists, creates, disables, enables and revokes the API keys of service-to-service clients
+// A created key is printed once, only the hash of its secret is kept
+func APIKeys(repo storage.APIKeyRepository, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(apiKeysUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) > 1 {
+			return errors.New(apiKeysUsage)
+		}
+		keys, err := repo.ListAPIKeys()
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			state, lastUsed := "enabled", "never used"
+			if k.Disabled {
+				state = "disabled"
+			}
+			if k.LastUsedAt != nil {
+				lastUsed = "last used " + k.LastUsedAt.UTC().Format(time.RFC3339)
+			}
+			access := k.Role
+			if k.Team != "" {
+				access += " of " + k.Team
+			}
+			fmt.Fprintf(out, "%s %s [%s] %s, %s, %s\n", k.ID, k.Name, k.Scopes, access, state, lastUsed)
+		}
+		if len(keys) == 0 {
+			fmt.Fprintln(out, "no API keys")
+		}
+		return nil
+
+	case "create":
+		return createAPIKey(repo, args[1:], out)
+
+	case "disable", "enable", "revoke":
+		if len(args) != 2 {
+			return errors.New(apiKeysUsage)
+		}
+		id := strings.ToUpper(args[1])
+
+		var err error
+		if args[0] == "revoke" {
+			err = repo.DeleteAPIKey(id)
+		} else {
+			err = repo.SetAPIKeyDisabled(id, args[0] == "disable")
+		}
+		if err == storage.ErrNotFound {
+			return fmt.Errorf("there is no API key %s", id)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "%sd API key %s\n", args[0], id)
+		return nil
+	}
+
+	return errors.New(apiKeysUsage)
+}
+
+// createAPIKey stores a new key with the given name, scopes, role and team and prints it
+func createAPIKey(repo storage.APIKeyRepository, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("apikeys create", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	name := fs.String("name", "", "name telling the client the key is for")
+	scope := fs.String("scope", utils.ScopeRead, "space or comma separated scopes granted by the key")
+	role := fs.String("role", utils.RoleViewer, "role of the client: "+strings.Join(utils.Roles, ", "))
+	team := fs.String("team", "", "team whose products an editor may change")
+
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *name == "" || len(*name) > 64 || len(*team) > 64 {
+		return errors.New(apiKeysUsage)
+	}
+	if !utils.IsRole(*role) {
+		return fmt.Errorf("unknown role %q, it has to be one of %s", *role, strings.Join(utils.Roles, ", "))
+	}
+	scopes := strings.FieldsFunc(*scope, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(scopes) == 0 {
+		return errors.New(apiKeysUsage)
+	}
+	for _, s := range scopes {
+		if !utils.IsScope(s) {
+			return fmt.Errorf("unknown scope %q, it has to be one of %s", s, strings.Join(utils.Scopes, ", "))
+		}
+	}
+
+	k := model.APIKey{
+		ID:        utils.GenerateUUID(),
+		Name:      *name,
+		Scopes:    strings.Join(scopes, " "),
+		Role:      *role,
+		Team:      *team,
+		CreatedAt: time.Now().UTC(),
+	}
+	key, hash, err := utils.GenerateAPIKey(k.ID)
+	if err != nil {
+		return err
+	}
+	k.Hash = hash
+
+	if err = repo.CreateAPIKey(&k); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "created API key %s named %s with scopes [%s] as %s, it is only shown once:\n%s\n", k.ID, k.Name, k.Scopes, k.Role, key)
+	return nil
+}
@@ -0,0 +1,70 @@
+package command
+
+import (
+	"../storage"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Command line tooling for the service
+// Each command receives its arguments without the command name itself and
+// writes a human readable report to the given output
+
+// Usage of the migrate command
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// Migrate applies, rolls back or reports on the schema migrations
+func Migrate(m *storage.Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := m.Up()
+		for _, mg := range done {
+			fmt.Fprintf(out, "applied %d %s\n", mg.Version, mg.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return errors.New("steps must be a positive number")
+			}
+			steps = n
+		}
+
+		done, err := m.Down(steps)
+		for _, mg := range done {
+			fmt.Fprintf(out, "rolled back %d %s\n", mg.Version, mg.Name)
+		}
+		return err
+
+	case "status":
+		current, err := m.Current()
+		if err != nil {
+			return err
+		}
+
+		pending, err := m.Pending()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "current version: %d\n", current)
+		for _, mg := range pending {
+			fmt.Fprintf(out, "pending %d %s\n", mg.Version, mg.Name)
+		}
+		return nil
+	}
+
+	return errors.New(migrateUsage)
+}
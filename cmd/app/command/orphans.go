@@ -0,0 +1,47 @@
+package command
+
+import (
+	"../storage"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Usage of the orphans command
+const orphansUsage = "usage: orphans [clean]"
+
+// Orphans reports the rows left behind by products and options which no longer exist,
+// and removes them when asked to clean
+func Orphans(repo storage.Repository, args []string, out io.Writer) error {
+	if len(args) > 1 || (len(args) == 1 && args[0] != "clean") {
+		return errors.New(orphansUsage)
+	}
+
+	if len(args) == 0 {
+		orphans, err := repo.Orphans()
+		if err != nil {
+			return err
+		}
+
+		for _, o := range orphans {
+			fmt.Fprintf(out, "%s: %d orphaned rows\n", o.Table, o.Rows)
+		}
+		if len(orphans) == 0 {
+			fmt.Fprintln(out, "no orphaned rows")
+		}
+		return nil
+	}
+
+	removed, err := repo.DeleteOrphans()
+	if err != nil {
+		return err
+	}
+
+	for _, o := range removed {
+		fmt.Fprintf(out, "removed %d orphaned rows from %s\n", o.Rows, o.Table)
+	}
+	if len(removed) == 0 {
+		fmt.Fprintln(out, "no orphaned rows")
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package command
+
+import (
+	"../storage"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Purge removes the products and options deleted longer than the retention ago for good
+// Meant for setups which run the purge from a scheduler rather than in the service
+func Purge(repo storage.Repository, retention time.Duration, out io.Writer) error {
+	result, err := repo.Purge(time.Now().UTC().Add(-retention))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "purged %d products and %d options deleted before %s\n",
+		result.Products, result.Options, result.Before.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"../utils"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Usage of the token command
+const tokenUsage = `usage: token -subject name [-scope "products:read products:write"] [-role viewer|editor|admin] [-team name] [-ttl 1h]`
+
+// Token issues a JWT for the subject with the given scopes, role and team, signed with the current key of the keyring
+func Token(keyring *utils.Keyring, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	subject := fs.String("subject", "", "caller the token is issued to")
+	scope := fs.String("scope", utils.ScopeRead, "space or comma separated scopes granted by the token")
+	role := fs.String("role", utils.RoleViewer, "role of the caller: "+strings.Join(utils.Roles, ", "))
+	team := fs.String("team", "", "team whose products an editor may change")
+	ttl := fs.Duration("ttl", time.Hour, "how long the token is valid")
+
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *subject == "" {
+		return errors.New(tokenUsage)
+	}
+
+	scopes := strings.FieldsFunc(*scope, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(scopes) == 0 {
+		return errors.New(tokenUsage)
+	}
+	for _, s := range scopes {
+		if !utils.IsScope(s) {
+			return errors.New(tokenUsage)
+		}
+	}
+	principal := utils.Principal{Subject: *subject, Scopes: scopes, Role: *role, Team: *team}
+	token, err := keyring.GenerateJWT(principal, *ttl)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, token)
+	return nil
+}
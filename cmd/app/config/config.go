@@ -0,0 +1,474 @@
+package config
+
+import (
+	"../model"
+	"../ratelimit"
+	"../utils"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// This is the configuration section
+// Settings are resolved in the following order, later sources winning:
+// built in defaults, the YAML config file, PRODUCT_* environment variables
+// and finally command line flags
+// The resolved configuration is validated before the service starts
+
+// Environment variable holding the path of the config file
+const FileEnv = "PRODUCT_CONFIG"
+
+// Config is the typed configuration of the service
+type Config struct {
+	Server  ServerConfig  `yaml:"server"`
+	Storage StorageConfig `yaml:"storage"`
+	Log     LogConfig     `yaml:"log"`
+	CORS    CORSConfig    `yaml:"cors"`
+	Auth    AuthConfig    `yaml:"auth"`
+	Pricing PricingConfig `yaml:"pricing"`
+	Trash   TrashConfig   `yaml:"trash"`
+
+	RateLimit RateLimitConfig `yaml:"rateLimit"`
+}
+
+// ServerConfig holds the web server settings
+// Writes to products and options without an If-Match header are refused when RequireIfMatch is set
+type ServerConfig struct {
+	Address        string `yaml:"address"`
+	RequireIfMatch bool   `yaml:"requireIfMatch"`
+}
+
+// StorageConfig holds the persistence settings
+type StorageConfig struct {
+	Backend     string `yaml:"backend"`
+	DSN         string `yaml:"dsn"`
+	AutoMigrate bool   `yaml:"autoMigrate"`
+}
+
+// LogConfig holds the logging settings
+type LogConfig struct {
+	Level string `yaml:"level"`
+}
+
+// CORSConfig holds the cross origin settings
+type CORSConfig struct {
+	AllowOrigins []string `yaml:"allowOrigins"`
+}
+
+// AuthConfig holds the security settings
+// Every request needs a bearer JWT while Enabled is set. Tokens are signed with one key given by
+// the JWT settings, known as the default key, or with the keys of a keyring for rotation, SigningKey
+// naming the one new tokens are signed with
+// HS256 keys use a secret, RS256 and ES256 keys PEM files holding their private or public key
+type AuthConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	JWTAlgorithm  string `yaml:"jwtAlgorithm"`
+	JWTSecret     string `yaml:"jwtSecret"`
+	JWTPrivateKey string `yaml:"jwtPrivateKey"`
+	JWTPublicKey  string `yaml:"jwtPublicKey"`
+
+	Keys       []KeyConfig `yaml:"keys"`
+	SigningKey string      `yaml:"signingKey"`
+
+	// Set when no secret was configured and a random one got generated
+	SecretGenerated bool `yaml:"-"`
+}
+
+// KeyConfig holds one key of the keyring, tokens signed with it are refused from RetireAt on
+type KeyConfig struct {
+	ID         string    `yaml:"kid"`
+	Algorithm  string    `yaml:"algorithm"`
+	Secret     string    `yaml:"secret"`
+	PrivateKey string    `yaml:"privateKey"`
+	PublicKey  string    `yaml:"publicKey"`
+	RetireAt   time.Time `yaml:"retireAt,omitempty"`
+}
+
+// DefaultKeyID is the kid of the key given by the JWT settings
+const DefaultKeyID = "default"
+
+// PricingConfig holds the currency settings
+// Rates give the amount of each currency worth one unit of the default currency
+type PricingConfig struct {
+	Currency string             `yaml:"currency"`
+	Rates    map[string]float64 `yaml:"rates"`
+}
+
+// TrashConfig holds the purge settings
+// Deleted products and options are purged once older than the retention, checked at
+// every purge interval, with a zero interval turning the purge job off
+type TrashConfig struct {
+	Retention     time.Duration `yaml:"retention"`
+	PurgeInterval time.Duration `yaml:"purgeInterval"`
+}
+
+// RateLimitConfig holds the request quotas
+// Every client has a token bucket per rule, the first rule matching the route and method of a
+// request applying to it, and requests matching no rule are not limited
+// Clients are told apart by API key or JWT subject, and by address when not authenticated,
+// the address being read from X-Forwarded-For and X-Real-IP only when TrustProxy is set
+type RateLimitConfig struct {
+	Enabled    bool             `yaml:"enabled"`
+	TrustProxy bool             `yaml:"trustProxy"`
+	Rules      []RateRuleConfig `yaml:"rules"`
+}
+
+// RateRuleConfig allows Requests per Per to a route and methods, in bursts of up to Burst requests,
+// Requests when not set
+// The route is a route path, a group of routes ending in /* or * for every route
+type RateRuleConfig struct {
+	Route    string        `yaml:"route"`
+	Methods  []string      `yaml:"methods,omitempty"`
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst,omitempty"`
+}
+
+// Default returns the configuration used when nothing else is given
+func Default() *Config {
+	return &Config{
+		Server:  ServerConfig{Address: "127.0.0.1:8080"},
+		Storage: StorageConfig{Backend: "sql", DSN: "./data/products.db"},
+		Log:     LogConfig{Level: "debug"},
+		CORS:    CORSConfig{AllowOrigins: []string{"*"}},
+		Auth:    AuthConfig{Enabled: true, JWTAlgorithm: "HS256"},
+		Pricing: PricingConfig{Currency: "USD"},
+		Trash:   TrashConfig{Retention: 30 * 24 * time.Hour, PurgeInterval: time.Hour},
+
+		// The listing loads the whole table, so it gets a tighter quota than the other reads
+		RateLimit: RateLimitConfig{Enabled: true, Rules: []RateRuleConfig{
+			{Route: "/products", Methods: []string{"GET", "HEAD"}, Requests: 60, Per: time.Minute, Burst: 10},
+			{Route: "*", Methods: []string{"GET", "HEAD"}, Requests: 600, Per: time.Minute, Burst: 100},
+			{Route: "*", Requests: 120, Per: time.Minute, Burst: 30},
+		}},
+	}
+}
+
+// Load resolves the configuration from the command line arguments, the environment
+// and the config file, returning the arguments left over after the flags
+func Load(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("product", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(FileEnv), "path of the YAML config file")
+
+	flags := make(map[string]*settingFlag, len(settings))
+	for _, s := range settings {
+		f := &settingFlag{boolean: s.boolean}
+		flags[s.flag] = f
+		fs.Var(f, s.flag, s.usage+" (env "+s.env+")")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := Default()
+
+	// Config file
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Environment then flags
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(cfg, v); err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if f := flags[s.flag]; f.value != nil {
+			if err := s.set(cfg, *f.value); err != nil {
+				return nil, nil, fmt.Errorf("-%s: %v", s.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	// Without a configured secret tokens only live as long as the process
+	if len(cfg.Auth.Keys) == 0 && cfg.Auth.JWTAlgorithm == "HS256" && cfg.Auth.JWTSecret == "" {
+		secret, err := randomSecret()
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.Auth.JWTSecret = secret
+		cfg.Auth.SecretGenerated = true
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// Validate checks the configuration is usable and reports every problem found
+func (c *Config) Validate() error {
+	var problems []string
+
+	if _, _, err := net.SplitHostPort(c.Server.Address); err != nil {
+		problems = append(problems, fmt.Sprintf("server.address %q is not a host:port pair", c.Server.Address))
+	}
+
+	if c.Storage.Backend != "sql" && c.Storage.Backend != "memory" {
+		problems = append(problems, fmt.Sprintf("storage.backend %q must be sql or memory", c.Storage.Backend))
+	}
+	if c.Storage.Backend == "sql" && c.Storage.DSN == "" {
+		problems = append(problems, "storage.dsn is required by the sql backend")
+	}
+
+	if _, ok := LogLevels[strings.ToLower(c.Log.Level)]; !ok {
+		problems = append(problems, fmt.Sprintf("log.level %q must be one of debug, info, warn, error, off", c.Log.Level))
+	}
+
+	if len(c.CORS.AllowOrigins) == 0 {
+		problems = append(problems, "cors.allowOrigins needs at least one origin")
+	}
+
+	problems = append(problems, c.Auth.problems()...)
+
+	if !model.IsCurrency(c.Pricing.Currency) {
+		problems = append(problems, fmt.Sprintf("pricing.currency %q is not an ISO 4217 currency code", c.Pricing.Currency))
+	}
+	for code, rate := range c.Pricing.Rates {
+		switch {
+		case !model.IsCurrency(code):
+			problems = append(problems, fmt.Sprintf("pricing.rates %q is not an ISO 4217 currency code", code))
+		case code == c.Pricing.Currency:
+			problems = append(problems, fmt.Sprintf("pricing.rates cannot hold the default currency %s", code))
+		case !(rate > 0):
+			problems = append(problems, fmt.Sprintf("pricing.rates %s must be above zero", code))
+		}
+	}
+
+	if c.Trash.Retention <= 0 {
+		problems = append(problems, "trash.retention must be above zero")
+	}
+	if c.Trash.PurgeInterval < 0 {
+		problems = append(problems, "trash.purgeInterval cannot be negative")
+	}
+
+	problems = append(problems, c.RateLimit.problems()...)
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// Print writes the effective configuration as YAML with secrets masked
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	if redacted.Auth.JWTSecret != "" {
+		redacted.Auth.JWTSecret = "********"
+	}
+	redacted.Auth.Keys = append([]KeyConfig(nil), c.Auth.Keys...)
+	for i := range redacted.Auth.Keys {
+		if redacted.Auth.Keys[i].Secret != "" {
+			redacted.Auth.Keys[i].Secret = "********"
+		}
+	}
+
+	out, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+// loadFile overlays the values found in the YAML file, rejecting unknown keys
+func (c *Config) loadFile(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %v", err)
+	}
+
+	if err = yaml.UnmarshalStrict(raw, c); err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// randomSecret returns a hex encoded 32 byte secret
+func randomSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Keyring returns the keys tokens are signed and verified with, reading the PEM files of the keys
+func (c *Config) Keyring() (*utils.Keyring, error) {
+	keys := c.Auth.Keys
+	if len(keys) == 0 {
+		keys = []KeyConfig{{ID: DefaultKeyID, Algorithm: c.Auth.JWTAlgorithm, Secret: c.Auth.JWTSecret,
+			PrivateKey: c.Auth.JWTPrivateKey, PublicKey: c.Auth.JWTPublicKey}}
+	}
+
+	var list []*utils.JWTKey
+	for _, k := range keys {
+		private, err := readPEM(k.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", k.ID, err)
+		}
+		public, err := readPEM(k.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", k.ID, err)
+		}
+
+		key, err := utils.NewJWTKey(k.ID, k.Algorithm, []byte(k.Secret), private, public)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", k.ID, err)
+		}
+		key.RetireAt = k.RetireAt
+		list = append(list, key)
+	}
+
+	return utils.NewKeyring(c.Auth.SigningKey, list...)
+}
+
+// readPEM reads a PEM file, nothing when no path is given
+func readPEM(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+// problems lists what is wrong with the keys, the default one or those of the keyring
+func (a *AuthConfig) problems() []string {
+	var problems []string
+	kids := map[string]bool{}
+
+	if len(a.Keys) == 0 {
+		kids[DefaultKeyID] = true
+		problems = keyProblems(problems, "auth.jwtAlgorithm", a.JWTAlgorithm, "auth.jwtSecret", a.JWTSecret,
+			"auth.jwtPrivateKey or auth.jwtPublicKey", a.JWTPrivateKey+a.JWTPublicKey)
+	} else if a.JWTSecret != "" || a.JWTPrivateKey != "" || a.JWTPublicKey != "" {
+		problems = append(problems, "auth.keys cannot be combined with auth.jwtSecret, auth.jwtPrivateKey or auth.jwtPublicKey")
+	}
+
+	for i, k := range a.Keys {
+		field := fmt.Sprintf("auth.keys[%d]", i)
+		switch {
+		case k.ID == "":
+			problems = append(problems, field+".kid is required")
+		case kids[k.ID]:
+			problems = append(problems, fmt.Sprintf("%s.kid %q is given more than once", field, k.ID))
+		}
+		kids[k.ID] = true
+
+		problems = keyProblems(problems, field+".algorithm", k.Algorithm, field+".secret", k.Secret,
+			field+".privateKey or "+field+".publicKey", k.PrivateKey+k.PublicKey)
+		if k.Algorithm == "HS256" && k.Secret == "" {
+			problems = append(problems, field+".secret is required by HS256")
+		}
+	}
+
+	if a.SigningKey != "" && !kids[a.SigningKey] {
+		problems = append(problems, fmt.Sprintf("auth.signingKey %q does not name a key", a.SigningKey))
+	}
+
+	return problems
+}
+
+// keyProblems adds what is wrong with the algorithm and material of one key
+func keyProblems(problems []string, algorithmField string, algorithm string, secretField string, secret string, pemField string, pem string) []string {
+	switch algorithm {
+	case "HS256":
+		if secret != "" && len(secret) < 16 {
+			problems = append(problems, secretField+" must be at least 16 characters")
+		}
+	case "RS256", "ES256":
+		if pem == "" {
+			problems = append(problems, pemField+" is required by "+algorithm)
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s %q must be HS256, RS256 or ES256", algorithmField, algorithm))
+	}
+
+	return problems
+}
+
+// LogSQL reports whether the statements run against the database are logged, which only happens at debug level
+func (c *Config) LogSQL() bool {
+	return strings.ToLower(c.Log.Level) == "debug"
+}
+
+// PricingModel returns the currency settings in the form used by the controller
+func (c *Config) PricingModel() model.Pricing {
+	return model.Pricing{Currency: c.Pricing.Currency, Rates: c.Pricing.Rates}
+}
+
+// problems lists what is wrong with the rate limit rules
+func (r *RateLimitConfig) problems() []string {
+	var problems []string
+
+	for i, rule := range r.Rules {
+		field := fmt.Sprintf("rateLimit.rules[%d]", i)
+		if rule.Route != "*" && !strings.HasPrefix(rule.Route, "/") {
+			problems = append(problems, fmt.Sprintf("%s.route %q must be * or start with /", field, rule.Route))
+		}
+		for _, m := range rule.Methods {
+			if !httpMethods[strings.ToUpper(m)] {
+				problems = append(problems, fmt.Sprintf("%s.methods %q is not an HTTP method", field, m))
+			}
+		}
+		if rule.Requests <= 0 {
+			problems = append(problems, field+".requests must be above zero")
+		}
+		if rule.Per <= 0 {
+			problems = append(problems, field+".per must be above zero")
+		}
+		if rule.Burst < 0 {
+			problems = append(problems, field+".burst cannot be negative")
+		}
+	}
+
+	return problems
+}
+
+// httpMethods holds the methods a rate limit rule may name
+var httpMethods = map[string]bool{"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true}
+
+// RateLimitRules returns the rules in the form used by the limiter
+func (c *Config) RateLimitRules() []ratelimit.Rule {
+	var rules []ratelimit.Rule
+	for _, r := range c.RateLimit.Rules {
+		burst := r.Burst
+		if burst == 0 {
+			burst = r.Requests
+		}
+
+		var methods []string
+		for _, m := range r.Methods {
+			methods = append(methods, strings.ToUpper(m))
+		}
+
+		rules = append(rules, ratelimit.Rule{
+			Route:   r.Route,
+			Methods: methods,
+			Limit:   ratelimit.Limit{Rate: float64(r.Requests) / r.Per.Seconds(), Burst: burst},
+		})
+	}
+
+	return rules
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Registry of the settings which can be overridden from the environment or flags
+// Every entry maps one flag and one environment variable onto a field of Config
+
+// LogLevels maps the accepted log level names onto the logger levels
+var LogLevels = map[string]log.Lvl{
+	"debug": log.DEBUG,
+	"info":  log.INFO,
+	"warn":  log.WARN,
+	"error": log.ERROR,
+	"off":   log.OFF,
+}
+
+type setting struct {
+	flag    string
+	env     string
+	usage   string
+	boolean bool
+	set     func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{
+		flag:  "address",
+		env:   "PRODUCT_SERVER_ADDRESS",
+		usage: "listen address of the web server",
+		set:   func(c *Config, v string) error { c.Server.Address = v; return nil },
+	},
+	{
+		flag:    "require-if-match",
+		env:     "PRODUCT_SERVER_REQUIRE_IF_MATCH",
+		usage:   "refuse updates and deletes of products and options without If-Match",
+		boolean: true,
+		set: func(c *Config, v string) (err error) {
+			c.Server.RequireIfMatch, err = strconv.ParseBool(v)
+			return err
+		},
+	},
+	{
+		flag:  "storage",
+		env:   "PRODUCT_STORAGE_BACKEND",
+		usage: "storage backend to use: sql or memory",
+		set:   func(c *Config, v string) error { c.Storage.Backend = v; return nil },
+	},
+	{
+		flag:  "dsn",
+		env:   "PRODUCT_STORAGE_DSN",
+		usage: "SQLite file path or Postgres connection string",
+		set:   func(c *Config, v string) error { c.Storage.DSN = v; return nil },
+	},
+	{
+		flag:    "migrate",
+		env:     "PRODUCT_STORAGE_AUTO_MIGRATE",
+		usage:   "apply pending schema migrations on start",
+		boolean: true,
+		set: func(c *Config, v string) (err error) {
+			c.Storage.AutoMigrate, err = strconv.ParseBool(v)
+			return err
+		},
+	},
+	{
+		flag:  "log-level",
+		env:   "PRODUCT_LOG_LEVEL",
+		usage: "log level: debug, info, warn, error or off",
+		set:   func(c *Config, v string) error { c.Log.Level = v; return nil },
+	},
+	{
+		flag:  "cors-origins",
+		env:   "PRODUCT_CORS_ALLOW_ORIGINS",
+		usage: "comma separated list of origins allowed by CORS",
+		set:   func(c *Config, v string) error { c.CORS.AllowOrigins = splitList(v); return nil },
+	},
+	{
+		flag:    "auth",
+		env:     "PRODUCT_AUTH_ENABLED",
+		usage:   "require a bearer JWT on every request",
+		boolean: true,
+		set: func(c *Config, v string) (err error) {
+			c.Auth.Enabled, err = strconv.ParseBool(v)
+			return err
+		},
+	},
+	{
+		flag:  "jwt-algorithm",
+		env:   "PRODUCT_AUTH_JWT_ALGORITHM",
+		usage: "algorithm JWTs are signed with: HS256, RS256 or ES256",
+		set:   func(c *Config, v string) error { c.Auth.JWTAlgorithm = strings.ToUpper(v); return nil },
+	},
+	{
+		flag:  "jwt-secret",
+		env:   "PRODUCT_AUTH_JWT_SECRET",
+		usage: "secret used to sign HS256 JWTs",
+		set:   func(c *Config, v string) error { c.Auth.JWTSecret = v; return nil },
+	},
+	{
+		flag:  "jwt-private-key",
+		env:   "PRODUCT_AUTH_JWT_PRIVATE_KEY",
+		usage: "path of the PEM encoded private key signing RS256 or ES256 JWTs",
+		set:   func(c *Config, v string) error { c.Auth.JWTPrivateKey = v; return nil },
+	},
+	{
+		flag:  "jwt-public-key",
+		env:   "PRODUCT_AUTH_JWT_PUBLIC_KEY",
+		usage: "path of the PEM encoded public key verifying RS256 or ES256 JWTs",
+		set:   func(c *Config, v string) error { c.Auth.JWTPublicKey = v; return nil },
+	},
+	{
+		flag:  "signing-key",
+		env:   "PRODUCT_AUTH_SIGNING_KEY",
+		usage: "kid of the key new JWTs are signed with",
+		set:   func(c *Config, v string) error { c.Auth.SigningKey = v; return nil },
+	},
+	{
+		flag:    "rate-limit",
+		env:     "PRODUCT_RATE_LIMIT_ENABLED",
+		usage:   "limit the requests of every client to the configured quotas",
+		boolean: true,
+		set: func(c *Config, v string) (err error) {
+			c.RateLimit.Enabled, err = strconv.ParseBool(v)
+			return err
+		},
+	},
+	{
+		flag:    "trust-proxy",
+		env:     "PRODUCT_RATE_LIMIT_TRUST_PROXY",
+		usage:   "tell unauthenticated clients apart by X-Forwarded-For and X-Real-IP",
+		boolean: true,
+		set: func(c *Config, v string) (err error) {
+			c.RateLimit.TrustProxy, err = strconv.ParseBool(v)
+			return err
+		},
+	},
+	{
+		flag:  "currency",
+		env:   "PRODUCT_PRICING_CURRENCY",
+		usage: "ISO 4217 code of the default currency",
+		set:   func(c *Config, v string) error { c.Pricing.Currency = strings.ToUpper(v); return nil },
+	},
+	{
+		flag:  "currency-rates",
+		env:   "PRODUCT_PRICING_RATES",
+		usage: "comma separated CODE=rate pairs converting out of the default currency",
+		set:   setRates,
+	},
+	{
+		flag:  "trash-retention",
+		env:   "PRODUCT_TRASH_RETENTION",
+		usage: "how long deleted products and options are kept, like 720h",
+		set: func(c *Config, v string) (err error) {
+			c.Trash.Retention, err = time.ParseDuration(v)
+			return err
+		},
+	},
+	{
+		flag:  "purge-interval",
+		env:   "PRODUCT_TRASH_PURGE_INTERVAL",
+		usage: "how often expired trash is purged, 0 turns the purge job off",
+		set: func(c *Config, v string) (err error) {
+			c.Trash.PurgeInterval, err = time.ParseDuration(v)
+			return err
+		},
+	},
+}
+
+// setRates reads a rate table written as EUR=0.92,GBP=0.79
+func setRates(c *Config, v string) error {
+	rates := make(map[string]float64)
+	for _, item := range splitList(v) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("rate %q is not a CODE=rate pair", item)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			return fmt.Errorf("rate %q is not a number", item)
+		}
+		rates[strings.ToUpper(strings.TrimSpace(parts[0]))] = rate
+	}
+
+	c.Pricing.Rates = rates
+	return nil
+}
+
+// settingFlag records whether, and to what, a flag was set on the command line
+type settingFlag struct {
+	value   *string
+	boolean bool
+}
+
+func (f *settingFlag) String() string {
+	if f == nil || f.value == nil {
+		return ""
+	}
+
+	return *f.value
+}
+
+func (f *settingFlag) Set(v string) error {
+	f.value = &v
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.boolean
+}
+
+// splitList turns a comma separated value into its trimmed, non empty parts
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"../model"
+	"../product"
+	"../utils"
+)
+
+// Access control section
+// A controller acts on behalf of a caller: viewers only read and only list published
+// products, editors list drafts, archived products and the trash as well and change
+// the products of their team along with their options, variants and stock, and admins
+// change everything, the trash included
+// A controller without a caller, as used when authentication is turned off and by
+// the purge job, lets everything through
+
+// As returns the controller acting on behalf of the caller
+func (pc *ProductController) As(caller *utils.Principal) product.Front {
+	c := *pc
+	c.caller = caller
+	return &c
+}
+
+// authorize returns the forbidden error unless the caller may change the product
+// Only editors need the product loaded, a missing one is then not found
+func (pc *ProductController) authorize(id string) error {
+	if pc.caller == nil || pc.caller.Role == utils.RoleAdmin {
+		return nil
+	}
+	if pc.caller.Role != utils.RoleEditor {
+		return utils.AccessForbidden()
+	}
+
+	product, err := pc.repo.GetProduct(id)
+	if err != nil {
+		return err
+	}
+	if product == nil {
+		return utils.NotFound()
+	}
+
+	return pc.mayChange(product.Team)
+}
+
+// mayChange returns the forbidden error unless the caller may change a product of the team
+// Editors without a team change nothing and products without a team are left to admins
+func (pc *ProductController) mayChange(team string) error {
+	if pc.caller == nil || pc.caller.Role == utils.RoleAdmin {
+		return nil
+	}
+	if pc.caller.Role == utils.RoleEditor && team != "" && team == pc.caller.Team {
+		return nil
+	}
+
+	return utils.AccessForbidden()
+}
+
+// settleTeam keeps a product the caller may change in its stored team unless another
+// one is given, which the caller has to be allowed to change products of as well
+func (pc *ProductController) settleTeam(product *model.Product, team string) error {
+	if err := pc.mayChange(team); err != nil {
+		return err
+	}
+	if product.Team == "" {
+		product.Team = team
+	}
+
+	return pc.mayChange(product.Team)
+}
+
+// mayList returns the forbidden error unless the caller may list products in the statuses,
+// no statuses standing for every one of them
+// Viewers only list published products, editors and admins list them all
+func (pc *ProductController) mayList(statuses []string) error {
+	if len(statuses) == 0 {
+		return pc.editorOrAdmin()
+	}
+	for _, status := range statuses {
+		if status != model.StatusPublished {
+			return pc.editorOrAdmin()
+		}
+	}
+
+	return nil
+}
+
+// editorOrAdmin returns the forbidden error unless the caller is an editor or an admin
+func (pc *ProductController) editorOrAdmin() error {
+	if pc.caller == nil || pc.caller.Role == utils.RoleAdmin || pc.caller.Role == utils.RoleEditor {
+		return nil
+	}
+
+	return utils.AccessForbidden()
+}
+
+// adminOnly returns the forbidden error unless the caller is an admin
+func (pc *ProductController) adminOnly() error {
+	if pc.caller == nil || pc.caller.Role == utils.RoleAdmin {
+		return nil
+	}
+
+	return utils.AccessForbidden()
+}
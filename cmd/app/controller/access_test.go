@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"../model"
+	"../storage"
+	"../utils"
+	"net/http"
+	"testing"
+)
+
+// TestViewersCannotSeeTheTrash checks viewers are refused the trash of products and options
+// while editors and admins list it
+func TestViewersCannotSeeTheTrash(t *testing.T) {
+	repo := storage.NewMemoryRepository()
+	product := model.Product{ID: utils.GenerateUUID(), Name: "Trash", Price: 1000, Team: "red"}
+	if err := repo.CreateProduct(&product); err != nil {
+		t.Fatal(err)
+	}
+	pc := NewProductController(repo, model.Pricing{Currency: "USD"})
+
+	viewer := pc.As(&utils.Principal{Subject: "v", Role: utils.RoleViewer})
+	if _, err := viewer.ListDeletedOptions(product.ID); !forbidden(err) {
+		t.Fatalf("viewer listing deleted options: expected forbidden, got %v", err)
+	}
+	if _, err := viewer.ListTrash(model.Page{}); !forbidden(err) {
+		t.Fatalf("viewer listing the trash: expected forbidden, got %v", err)
+	}
+	if _, err := viewer.List(model.ProductQuery{Statuses: []string{model.StatusDraft}}); !forbidden(err) {
+		t.Fatalf("viewer listing drafts: expected forbidden, got %v", err)
+	}
+
+	for _, role := range []string{utils.RoleEditor, utils.RoleAdmin} {
+		caller := pc.As(&utils.Principal{Subject: role, Role: role, Team: "red"})
+		if _, err := caller.ListDeletedOptions(product.ID); err != nil {
+			t.Fatalf("%s listing deleted options: %v", role, err)
+		}
+		if _, err := caller.ListTrash(model.Page{}); err != nil {
+			t.Fatalf("%s listing the trash: %v", role, err)
+		}
+	}
+}
+
+// forbidden reports whether the error refuses the caller access
+func forbidden(err error) bool {
+	e, ok := err.(*utils.Error)
+	return ok && e.Status == http.StatusForbidden
+}
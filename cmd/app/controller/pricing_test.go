@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"../model"
+	"../storage"
+	"../utils"
+	"net/http"
+	"testing"
+)
+
+// TestPricesFollowTheMinorUnitsOfTheirCurrency checks conversions are rounded to the minor unit of the currency
+// and range checked, and explicit prices may not have more decimal places than their currency
+func TestPricesFollowTheMinorUnitsOfTheirCurrency(t *testing.T) {
+	repo := storage.NewMemoryRepository()
+	pricing := model.Pricing{Currency: "USD", Rates: map[string]float64{"JPY": 151.237, "KWD": 0.30712, "IDR": 1e12}}
+	pc := NewProductController(repo, pricing)
+
+	product := model.Product{Name: "Lamp", Price: 12340}
+	if err := pc.CreateProduct(&product); err != nil {
+		t.Fatal(err)
+	}
+
+	// 12.34 USD is 1866.26 JPY, rounded to whole yen, and 3.78986 KWD, rounded to the fils
+	for currency, expected := range map[string]model.Money{"JPY": 1866000, "KWD": 3790} {
+		got, err := pc.GetByID(product.ID, currency)
+		if err != nil || got.Price != expected {
+			t.Fatalf("price in %s: expected %s, got %v %v", currency, expected, got, err)
+		}
+	}
+	if _, err := pc.GetByID(product.ID, "IDR"); !invalid(err) {
+		t.Fatalf("price past the largest amount: expected invalid request, got %v", err)
+	}
+
+	product.Prices = []model.ProductPrice{{Currency: "JPY", Price: 1500}}
+	if err := pc.UpdateProduct(&product); !invalid(err) {
+		t.Fatalf("price of 1.5 JPY: expected invalid request, got %v", err)
+	}
+	product.Prices = []model.ProductPrice{{Currency: "JPY", Price: 2000000}, {Currency: "KWD", Price: 3795}}
+	if err := pc.UpdateProduct(&product); err != nil {
+		t.Fatalf("prices in whole yen and fils: %v", err)
+	}
+}
+
+// invalid reports whether the error rejects the request as invalid
+func invalid(err error) bool {
+	if _, ok := err.(utils.ValidationErrors); ok {
+		return true
+	}
+	e, ok := err.(*utils.Error)
+	return ok && e.Status == http.StatusBadRequest
+}
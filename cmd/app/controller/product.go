@@ -2,8 +2,9 @@ package controller
 
 import (
 	"../model"
+	"../storage"
 	"../utils"
-	"github.com/jinzhu/gorm"
+	"fmt"
 )
 
 // This is the product controller section
@@ -11,120 +12,476 @@ import (
 // sits in here
 // This layer applies the necessary processing and orchestration needed for the data for storage
 // and relevant enrichment for presentation and experience for the calling layer
+// Persistence is delegated to a storage repository so the backend can be swapped
+
+// patchAttempts is how often an unconditional patch is retried when it loses a race
+const patchAttempts = 3
 
 // Controller field holder
 type ProductController struct {
-	db *gorm.DB
+	repo    storage.Repository
+	pricing model.Pricing
+
+	// The caller the controller acts on behalf of, nil when authentication is off
+	caller *utils.Principal
 }
 
-// Constructor returning an instance of the controller which carries the injected DB
-func NewProductController(db *gorm.DB) *ProductController {
+// Constructor returning an instance of the controller which carries the injected repository
+// and the currency settings prices are read with
+func NewProductController(repo storage.Repository, pricing model.Pricing) *ProductController {
 	return &ProductController{
-		db: db,
+		repo:    repo,
+		pricing: pricing,
 	}
 }
 
-func (pc *ProductController) List() (model.ProductList, error) {
-	var products []model.Product
+// List returns one page of the products matching the query
+// One row more than asked for is fetched to find out whether a next page exists
+func (pc *ProductController) List(q model.ProductQuery) (model.ProductList, error) {
+	if err := pc.mayList(q.Statuses); err != nil {
+		return model.ProductList{}, err
+	}
 
-	pc.db.Find(&products)
+	limit := normalizePage(&q.Page)
+	q.Page.Limit = limit + 1
 
-	return model.ProductList{Items: products}, pc.db.Error
-}
+	products, total, err := pc.repo.ListProducts(q)
+	if err != nil {
+		return model.ProductList{}, err
+	}
 
-func (pc *ProductController) ListByName(name string) (model.ProductList, error) {
-	var products []model.Product
+	meta := &model.ListMeta{Total: total, Limit: limit, Offset: q.Page.Offset}
+	if len(products) > limit {
+		products = products[:limit]
+		last := products[limit-1]
+		meta.NextCursor = nextCursor(q.Sort, q.Page, limit, last.SortValue(q.Sort.Field), last.ID)
+	}
 
-	pc.db.Where(&model.Product{Name: name}).Find(&products)
+	// Paging and sorting use the default currency, only the page read is priced
+	for i := range products {
+		if err = pc.price(&products[i], q.Currency); err != nil {
+			return model.ProductList{}, err
+		}
+	}
 
-	return model.ProductList{Items: products}, pc.db.Error
+	return model.ProductList{Items: products, Meta: meta}, nil
 }
 
-func (pc *ProductController) GetByID(id string) (*model.Product, error) {
-	var product model.Product
+// GetByID returns the product with its prices in the given currency, the default one when empty
+func (pc *ProductController) GetByID(id string, currency string) (*model.Product, error) {
+	product, err := pc.repo.GetProduct(id)
+	if err != nil || product == nil {
+		return product, err
+	}
 
-	err := pc.db.Where("Id = ?", id).Find(&product).Error
+	return product, pc.price(product, currency)
+}
+
+// CreateProduct adds a draft product, owned by the caller and kept by default in the team of the caller
+func (pc *ProductController) CreateProduct(product *model.Product) error {
+	if product.Team == "" && pc.caller != nil {
+		product.Team = pc.caller.Team
+	}
+	if err := pc.mayChange(product.Team); err != nil {
+		return err
+	}
+
+	if err := pc.checkPrices(product); err != nil {
+		return err
+	}
+
+	product.ID = utils.GenerateUUID()
+	product.Status = model.StatusDraft
+	product.Owner = ""
+	if pc.caller != nil {
+		product.Owner = pc.caller.Subject
+	}
+	return translate(pc.repo.CreateProduct(product))
+}
 
+// UpdateProduct replaces the editable fields and prices of a product, its status only changes through Transition
+// The product carries the version the change expects, 0 for any, and comes back with the new one
+// It stays in its team unless another one is given
+func (pc *ProductController) UpdateProduct(product *model.Product) error {
+	stored, err := pc.repo.GetProduct(product.ID)
 	if err != nil {
-		if gorm.IsRecordNotFoundError(err) {
-			return nil, nil
-		}
+		return err
+	}
+	if stored == nil {
+		return utils.NotFound()
+	}
+	if err = pc.settleTeam(product, stored.Team); err != nil {
+		return err
+	}
 
-		return nil, err
+	if err = pc.checkPrices(product); err != nil {
+		return err
 	}
 
-	return &product, nil
+	product.Status = ""
+	return translate(pc.repo.ReplaceProduct(product))
 }
 
-func (pc *ProductController) CreateProduct(product *model.Product) error {
-	product.ID = utils.GenerateUUID()
-	return pc.db.Create(&product).Error
+// PatchProduct applies the edit to the stored product and replaces it with the outcome
+// The edit runs against the version given, 0 for the latest, and is retried when the product
+// changes underneath an unconditional patch
+func (pc *ProductController) PatchProduct(id string, version int, edit func(*model.Product) error) (*model.Product, error) {
+	for attempt := 0; ; attempt++ {
+		product, err := pc.repo.GetProduct(id)
+		if err != nil {
+			return nil, err
+		}
+		if product == nil {
+			return nil, utils.NotFound()
+		}
+		team := product.Team
+		if err = pc.mayChange(team); err != nil {
+			return nil, err
+		}
+		if version != 0 && version != product.Version {
+			return nil, translate(storage.ErrVersionMismatch)
+		}
+
+		if err = edit(product); err != nil {
+			return nil, err
+		}
+		if err = pc.settleTeam(product, team); err != nil {
+			return nil, err
+		}
+		if err = pc.checkPrices(product); err != nil {
+			return nil, err
+		}
+
+		err = pc.repo.ReplaceProduct(product)
+		if err == storage.ErrVersionMismatch && version == 0 && attempt < patchAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, translate(err)
+		}
+
+		return pc.GetByID(id, "")
+	}
 }
 
-func (pc *ProductController) UpdateProduct(product *model.Product) error {
-	if pc.db.Model(&model.Product{ID: product.ID}).Updates(&product).RowsAffected == 0 && &pc.db.Error == nil {
-		return gorm.ErrRecordNotFound
+// Transition takes the named action on a product, returning the product in its new status
+// Actions which do not apply to the current status are refused with a conflict
+func (pc *ProductController) Transition(id string, action string) (*model.Product, error) {
+	t, ok := model.ProductTransitions[action]
+	if !ok {
+		return nil, utils.InvalidRequest("unknown action " + action)
 	}
 
-	return pc.db.Error
+	product, err := pc.repo.GetProduct(id)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, utils.NotFound()
+	}
+	if err = pc.mayChange(product.Team); err != nil {
+		return nil, err
+	}
+	if product.Status != t.From {
+		return nil, utils.Conflict(fmt.Sprintf("cannot %s a %s product, it has to be %s", action, product.Status, t.From))
+	}
+
+	// The status is only changed when nobody moved the product on in the meantime
+	if err = pc.repo.SetProductStatus(id, t.From, t.To); err != nil {
+		if err == storage.ErrNotFound {
+			return nil, utils.Conflict("the product status changed in the meantime")
+		}
+		return nil, err
+	}
+
+	return pc.GetByID(id, "")
 }
 
+// DeleteProduct moves a product to the trash, as long as it is still at the version it carries
 func (pc *ProductController) DeleteProduct(product *model.Product) error {
-	if pc.db.Delete(&product).RowsAffected == 0 && pc.db.Error == nil {
-		return gorm.ErrRecordNotFound
+	if err := pc.authorize(product.ID); err != nil {
+		return err
 	}
 
-	return pc.db.Error
+	return translate(pc.repo.DeleteProduct(product.ID, product.Version))
 }
 
-func (pc *ProductController) ListOptions(id string) (model.ProductOptionList, error) {
-	var productOptions []model.ProductOption
+// ListOptions returns one page of the options of a product
+func (pc *ProductController) ListOptions(id string, q model.OptionQuery) (model.ProductOptionList, error) {
+	limit := normalizePage(&q.Page)
+	q.Page.Limit = limit + 1
 
-	pc.db.Table("ProductOptions").
-		Where("ProductId = ?", id).Find(&productOptions)
+	productOptions, total, err := pc.repo.ListOptions(id, q)
+	if err != nil {
+		return model.ProductOptionList{}, err
+	}
 
-	return model.ProductOptionList{Items: productOptions}, pc.db.Error
+	meta := &model.ListMeta{Total: total, Limit: limit, Offset: q.Page.Offset}
+	if len(productOptions) > limit {
+		productOptions = productOptions[:limit]
+		last := productOptions[limit-1]
+		meta.NextCursor = nextCursor(q.Sort, q.Page, limit, last.SortValue(q.Sort.Field), last.ID)
+	}
+
+	return model.ProductOptionList{Items: productOptions, Meta: meta}, nil
 }
 
 func (pc *ProductController) CreateOption(productOption *model.ProductOption) error {
+	if err := pc.authorize(productOption.ProductID); err != nil {
+		return err
+	}
+
+	if err := pc.checkAdjustments(productOption); err != nil {
+		return err
+	}
+
 	productOption.ID = utils.GenerateUUID()
-	return pc.db.Table("ProductOptions").Create(&productOption).Error
+	return translate(pc.repo.CreateOption(productOption))
 }
 
 func (pc *ProductController) GetSpecificOption(id string, optionId string) (*model.ProductOption, error) {
-	var productOption model.ProductOption
+	return pc.repo.GetOption(id, optionId)
+}
+
+// UpdateSpecificOption replaces the editable fields of an option, versioned like UpdateProduct
+func (pc *ProductController) UpdateSpecificOption(id string, optionId string, po *model.ProductOption) error {
+	if err := pc.authorize(id); err != nil {
+		return err
+	}
+
+	if err := pc.checkAdjustments(po); err != nil {
+		return err
+	}
+
+	return translate(pc.repo.ReplaceOption(id, optionId, po))
+}
 
-	if pc.db.Table("ProductOptions").
-		Where("ProductId = ? AND Id = ?", id, optionId).
-		Find(&productOption).RowsAffected == 0 {
-		if pc.db.Error != nil {
-			return nil, pc.db.Error
+// PatchSpecificOption applies the edit to the stored option and replaces it with the outcome, like PatchProduct
+func (pc *ProductController) PatchSpecificOption(id string, optionId string, version int, edit func(*model.ProductOption) error) (*model.ProductOption, error) {
+	if err := pc.authorize(id); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		option, err := pc.repo.GetOption(id, optionId)
+		if err != nil {
+			return nil, err
+		}
+		if option == nil {
+			return nil, utils.NotFound()
 		}
-		return nil, nil
+		if version != 0 && version != option.Version {
+			return nil, translate(storage.ErrVersionMismatch)
+		}
+
+		if err = edit(option); err != nil {
+			return nil, err
+		}
+		if err = pc.checkAdjustments(option); err != nil {
+			return nil, err
+		}
+
+		err = pc.repo.ReplaceOption(id, optionId, option)
+		if err == storage.ErrVersionMismatch && version == 0 && attempt < patchAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, translate(err)
+		}
+
+		return pc.repo.GetOption(id, optionId)
 	}
+}
 
-	return &productOption, pc.db.Error
+// DeleteSpecificOption moves an option to the trash, as long as it is still at the given version, 0 for any
+func (pc *ProductController) DeleteSpecificOption(id string, optionId string, version int) error {
+	if err := pc.authorize(id); err != nil {
+		return err
+	}
+
+	return translate(pc.repo.DeleteOption(id, optionId, version))
 }
 
-func (pc *ProductController) UpdateSpecificOption(id string, optionId string, po *model.ProductOption) error {
-	if pc.db.Table("ProductOptions").
-		Where("Id = ? AND ProductId = ?", optionId, id).
-		Model(model.ProductOption{}).
-		Omit("Id").
-		Updates(&po).
-		RowsAffected == 0 && pc.db.Error == nil {
-		return gorm.ErrRecordNotFound
+// EffectivePrice works out what the product costs with the chosen options, in the given currency
+// Option adjustments are kept in the default currency and converted with the rate table
+func (pc *ProductController) EffectivePrice(id string, optionIDs []string, currency string) (*model.EffectivePrice, error) {
+	product, err := pc.GetByID(id, currency)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, utils.NotFound()
+	}
+
+	var options []model.ProductOption
+	for _, optionID := range optionIDs {
+		option, err := pc.repo.GetOption(id, optionID)
+		if err != nil {
+			return nil, err
+		}
+		if option == nil {
+			return nil, utils.NotFoundError("option " + optionID + " is not an option of product " + id)
+		}
+		options = append(options, *option)
+	}
+
+	ep := &model.EffectivePrice{
+		ProductID:         id,
+		OptionIDs:         optionIDs,
+		Currency:          product.Currency,
+		BasePrice:         product.Price,
+		BaseDeliveryPrice: product.DeliveryPrice,
+	}
+
+	adjustments, err := pc.convert(model.PriceAdjustments(options), product.Currency)
+	if err != nil {
+		return nil, err
+	}
+	var clash string
+	if ep.Price, clash = model.Adjust(product.Price, adjustments); clash != "" {
+		return nil, utils.InvalidRequest("option " + clash + " overrides the price which another chosen option already overrides")
+	}
+
+	if adjustments, err = pc.convert(model.DeliveryPriceAdjustments(options), product.Currency); err != nil {
+		return nil, err
+	}
+	if ep.DeliveryPrice, clash = model.Adjust(product.DeliveryPrice, adjustments); clash != "" {
+		return nil, utils.InvalidRequest("option " + clash + " overrides the delivery price which another chosen option already overrides")
+	}
+
+	return ep, nil
+}
+
+// convert turns option adjustments from the default currency into the given one
+func (pc *ProductController) convert(adjustments []model.Adjustment, currency string) ([]model.Adjustment, error) {
+	for i, a := range adjustments {
+		if a.Mode == "" || a.Amount == 0 {
+			continue
+		}
+
+		amount, err := pc.pricing.Convert(a.Amount, currency)
+		if err == model.ErrNoRate {
+			return nil, utils.NotFoundError("option " + a.OptionID + " has no price adjustment in " + currency)
+		}
+		if err != nil {
+			return nil, utils.InvalidRequest("the price adjustment of option " + a.OptionID + " in " + currency + " " + err.Error())
+		}
+		adjustments[i].Amount = amount
+	}
+
+	return adjustments, nil
+}
+
+// price sets Price and DeliveryPrice of the product in the given currency
+// An explicit price wins over converting the default one with the rate table
+func (pc *ProductController) price(product *model.Product, currency string) error {
+	if currency == "" {
+		currency = pc.pricing.Currency
+	}
+	product.Currency = currency
+
+	if currency == pc.pricing.Currency {
+		return nil
+	}
+
+	for _, p := range product.Prices {
+		if p.Currency == currency {
+			product.Price, product.DeliveryPrice = p.Price, p.DeliveryPrice
+			return nil
+		}
+	}
+
+	price, err := pc.pricing.Convert(product.Price, currency)
+	if err == model.ErrNoRate {
+		return utils.NotFoundError("product " + product.ID + " has no price in " + currency)
+	}
+	if err != nil {
+		return utils.InvalidRequest("the price of product " + product.ID + " in " + currency + " " + err.Error())
+	}
+	deliveryPrice, err := pc.pricing.Convert(product.DeliveryPrice, currency)
+	if err != nil {
+		return utils.InvalidRequest("the delivery price of product " + product.ID + " in " + currency + " " + err.Error())
+	}
+	product.Price, product.DeliveryPrice = price, deliveryPrice
+
+	return nil
+}
+
+// checkPrices rejects explicit prices in the default currency, which belong in Price and DeliveryPrice,
+// and amounts with more decimal places than their currency has
+func (pc *ProductController) checkPrices(product *model.Product) error {
+	v := utils.NewValidator()
+	checkDecimals(v, "Price", product.Price, pc.pricing.Currency)
+	checkDecimals(v, "DeliveryPrice", product.DeliveryPrice, pc.pricing.Currency)
+	for i, p := range product.Prices {
+		v.Check(p.Currency != pc.pricing.Currency, fmt.Sprintf("Prices[%d].Currency", i), utils.RuleCurrency,
+			p.Currency+" is the default currency, use Price and DeliveryPrice instead")
+		checkDecimals(v, fmt.Sprintf("Prices[%d].Price", i), p.Price, p.Currency)
+		checkDecimals(v, fmt.Sprintf("Prices[%d].DeliveryPrice", i), p.DeliveryPrice, p.Currency)
+	}
+
+	return v.Err()
+}
+
+// checkAdjustments rejects option adjustments with more decimal places than the default currency has
+func (pc *ProductController) checkAdjustments(option *model.ProductOption) error {
+	v := utils.NewValidator()
+	checkDecimals(v, "PriceAdjustment", option.PriceAdjustment, pc.pricing.Currency)
+	checkDecimals(v, "DeliveryPriceAdjustment", option.DeliveryPriceAdjustment, pc.pricing.Currency)
+
+	return v.Err()
+}
+
+// checkDecimals records a violation when the amount has more decimal places than the currency has
+func checkDecimals(v *utils.Validator, field string, amount model.Money, currency string) {
+	units := model.MinorUnits(currency)
+	message := fmt.Sprintf("%s may have at most %d decimal places in %s", field, units, currency)
+	if units == 0 {
+		message = field + " must be a whole amount in " + currency
+	}
+	v.Check(amount.Fits(units), field, utils.RuleDecimal, message)
+}
+
+// translate turns storage failures into errors telling the client what went wrong
+// Anything else is left for the error handler to report as internal
+func translate(err error) error {
+	switch err {
+	case storage.ErrNotFound:
+		return utils.NotFound()
+	case storage.ErrDuplicate, storage.ErrInsufficientStock, storage.ErrReservationClosed:
+		return utils.Conflict(err.Error())
+	case storage.ErrVersionMismatch:
+		return utils.PreconditionFailed(err.Error())
+	}
+
+	return err
+}
+
+// normalizePage clamps the page size and returns it, a cursor takes precedence over the offset
+// Relevance cursors carry an offset and are turned back into one
+func normalizePage(page *model.Page) int {
+	if page.Limit <= 0 {
+		page.Limit = model.DefaultLimit
+	}
+	if page.Limit > model.MaxLimit {
+		page.Limit = model.MaxLimit
+	}
+	if page.Cursor != nil {
+		page.Offset = 0
+		if page.Cursor.Field == model.SortRelevance {
+			page.Offset = page.Cursor.Offset
+			page.Cursor = nil
+		}
 	}
 
-	return pc.db.Error
+	return page.Limit
 }
 
-func (pc *ProductController) DeleteSpecificOption(id string, optionId string) error {
-	if pc.db.Table("ProductOptions").
-		Delete(&model.ProductOption{ProductID: id, ID: optionId}).
-		RowsAffected == 0 && pc.db.Error == nil {
-		return gorm.ErrRecordNotFound
+// nextCursor builds the cursor continuing right after the last row of a page
+func nextCursor(s model.Sort, page model.Page, limit int, value interface{}, id string) string {
+	if s.Field == model.SortRelevance {
+		return model.Cursor{Field: s.Field, Desc: s.Desc, Offset: page.Offset + limit}.Encode()
 	}
 
-	return pc.db.Error
+	return model.Cursor{Field: s.Field, Desc: s.Desc, Value: value, ID: id}.Encode()
 }
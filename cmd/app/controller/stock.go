@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"../model"
+	"../storage"
+	"../utils"
+)
+
+// Stock of a product and its options
+// Levels are kept per product, or per option, and units are held by reservations
+// until they are released or committed
+
+// ListStock returns the stock levels of a product, the product level first and then by option
+func (pc *ProductController) ListStock(id string) (model.StockList, error) {
+	if err := pc.exists(id); err != nil {
+		return model.StockList{}, err
+	}
+
+	levels, err := pc.repo.ListStock(id)
+	if err != nil {
+		return model.StockList{}, err
+	}
+
+	return model.StockList{Items: levels}, nil
+}
+
+// SetStock sets the units on hand and the low stock threshold of a product, or of
+// one of its options when the option ID is given
+func (pc *ProductController) SetStock(stock *model.Stock) error {
+	if err := pc.authorize(stock.ProductID); err != nil {
+		return err
+	}
+
+	if err := pc.stockOwner(stock.ProductID, stock.OptionID); err != nil {
+		return err
+	}
+
+	return translate(pc.repo.SetStock(stock))
+}
+
+// Reserve holds units of a product or option for a pending order
+func (pc *ProductController) Reserve(reservation *model.StockReservation) error {
+	if err := pc.authorize(reservation.ProductID); err != nil {
+		return err
+	}
+
+	if err := pc.stockOwner(reservation.ProductID, reservation.OptionID); err != nil {
+		return err
+	}
+
+	reservation.ID = utils.GenerateUUID()
+	err := pc.repo.Reserve(reservation)
+	if err == storage.ErrNotFound {
+		return utils.NotFoundError("no stock is tracked for the product or option")
+	}
+
+	return translate(err)
+}
+
+func (pc *ProductController) GetReservation(id string, reservationId string) (*model.StockReservation, error) {
+	return pc.repo.GetReservation(id, reservationId)
+}
+
+// ReleaseReservation makes the units of an open reservation available again
+func (pc *ProductController) ReleaseReservation(id string, reservationId string) (*model.StockReservation, error) {
+	if err := pc.authorize(id); err != nil {
+		return nil, err
+	}
+
+	reservation, err := pc.repo.CloseReservation(id, reservationId, model.ReservationReleased)
+	return reservation, translate(err)
+}
+
+// CommitReservation takes the units of an open reservation off hand
+func (pc *ProductController) CommitReservation(id string, reservationId string) (*model.StockReservation, error) {
+	if err := pc.authorize(id); err != nil {
+		return nil, err
+	}
+
+	reservation, err := pc.repo.CloseReservation(id, reservationId, model.ReservationCommitted)
+	return reservation, translate(err)
+}
+
+// ListMovements returns one page of the stock ledger of a product, oldest first
+func (pc *ProductController) ListMovements(id string, page model.Page) (model.StockMovementList, error) {
+	if err := pc.exists(id); err != nil {
+		return model.StockMovementList{}, err
+	}
+
+	limit := normalizePage(&page)
+	movements, total, err := pc.repo.ListMovements(id, page)
+	if err != nil {
+		return model.StockMovementList{}, err
+	}
+
+	return model.StockMovementList{
+		Items: movements,
+		Meta:  &model.ListMeta{Total: total, Limit: limit, Offset: page.Offset},
+	}, nil
+}
+
+// stockOwner returns a not found error unless the product, and the option when given, exist
+func (pc *ProductController) stockOwner(id string, optionId string) error {
+	if err := pc.exists(id); err != nil || optionId == "" {
+		return err
+	}
+
+	option, err := pc.repo.GetOption(id, optionId)
+	if err != nil {
+		return err
+	}
+	if option == nil {
+		return utils.NotFoundError("option not found")
+	}
+
+	return nil
+}
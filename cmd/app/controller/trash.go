@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"../model"
+	"time"
+)
+
+// Trash of deleted products and options
+// Deleted items can be listed and restored until the purge job removes them
+// for good once they are older than the retention window
+
+// Logger is the part of the service logger the purge job reports to
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// ListTrash returns one page of the deleted products, most recently deleted first, which viewers may not see
+func (pc *ProductController) ListTrash(page model.Page) (model.ProductList, error) {
+	if err := pc.editorOrAdmin(); err != nil {
+		return model.ProductList{}, err
+	}
+
+	limit := normalizePage(&page)
+
+	products, total, err := pc.repo.ListDeletedProducts(page)
+	if err != nil {
+		return model.ProductList{}, err
+	}
+
+	return model.ProductList{
+		Items: products,
+		Meta:  &model.ListMeta{Total: total, Limit: limit, Offset: page.Offset},
+	}, nil
+}
+
+// RestoreProduct brings a deleted product back along with the options deleted with it, which only admins may do
+func (pc *ProductController) RestoreProduct(id string) (*model.Product, error) {
+	if err := pc.adminOnly(); err != nil {
+		return nil, err
+	}
+	if err := pc.repo.RestoreProduct(id); err != nil {
+		return nil, translate(err)
+	}
+
+	return pc.GetByID(id, "")
+}
+
+// PurgeProduct removes a deleted product for good, which only admins may do
+func (pc *ProductController) PurgeProduct(id string) error {
+	if err := pc.adminOnly(); err != nil {
+		return err
+	}
+
+	return translate(pc.repo.PurgeProduct(id))
+}
+
+// ListDeletedOptions returns the deleted options of a product, most recently deleted first, which viewers may not see
+func (pc *ProductController) ListDeletedOptions(id string) (model.ProductOptionList, error) {
+	if err := pc.editorOrAdmin(); err != nil {
+		return model.ProductOptionList{}, err
+	}
+	if err := pc.exists(id); err != nil {
+		return model.ProductOptionList{}, err
+	}
+
+	options, err := pc.repo.ListDeletedOptions(id)
+	if err != nil {
+		return model.ProductOptionList{}, err
+	}
+
+	return model.ProductOptionList{Items: options}, nil
+}
+
+// RestoreOption brings a deleted option of a product back
+func (pc *ProductController) RestoreOption(id string, optionId string) (*model.ProductOption, error) {
+	if err := pc.authorize(id); err != nil {
+		return nil, err
+	}
+
+	if err := pc.exists(id); err != nil {
+		return nil, err
+	}
+	if err := pc.repo.RestoreOption(id, optionId); err != nil {
+		return nil, translate(err)
+	}
+
+	return pc.repo.GetOption(id, optionId)
+}
+
+// Purge removes everything deleted longer than the retention window ago for good
+func (pc *ProductController) Purge(retention time.Duration) (model.PurgeResult, error) {
+	return pc.repo.Purge(time.Now().UTC().Add(-retention))
+}
+
+// PurgeEvery runs the purge at every interval until the process ends
+func (pc *ProductController) PurgeEvery(interval time.Duration, retention time.Duration, log Logger) {
+	for range time.Tick(interval) {
+		result, err := pc.Purge(retention)
+		if err != nil {
+			log.Errorf("purge failed: %v", err)
+			continue
+		}
+		if result.Products > 0 || result.Options > 0 {
+			log.Infof("purged %d products and %d options deleted before %s",
+				result.Products, result.Options, result.Before.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package controller
+
+import (
+	"../model"
+	"../utils"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Option groups and variants of a product
+// Groups are read off the options sharing a Group, and variants are generated
+// as every combination of one option from each group
+
+// Groups returns the option groups of a product ordered by name, with their options ordered by name
+func (pc *ProductController) Groups(id string) ([]model.OptionGroup, error) {
+	options, err := pc.options(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupOptions(options), nil
+}
+
+// CreateGroup adds an option for every value of the group
+func (pc *ProductController) CreateGroup(id string, group *model.OptionGroup) error {
+	if err := pc.authorize(id); err != nil {
+		return err
+	}
+
+	if err := pc.exists(id); err != nil {
+		return err
+	}
+
+	for i := range group.Options {
+		option := &group.Options[i]
+		option.ID = utils.GenerateUUID()
+		option.Group = group.Name
+	}
+
+	// The options of a group are stored together or not at all
+	return translate(pc.repo.CreateOptions(id, group.Options))
+}
+
+// ListVariants returns the variants of a product ordered by SKU
+func (pc *ProductController) ListVariants(id string) (model.ProductVariantList, error) {
+	if err := pc.exists(id); err != nil {
+		return model.ProductVariantList{}, err
+	}
+
+	variants, err := pc.repo.ListVariants(id)
+	if err != nil {
+		return model.ProductVariantList{}, err
+	}
+
+	return model.ProductVariantList{Items: variants}, nil
+}
+
+// GenerateVariants adds a variant for every combination of options which has none yet
+// New variants are enabled and priced with the adjustments of their options, while
+// variants which are not one option from each current group are disabled, such as those
+// referring to a deleted option or missing a group added since
+func (pc *ProductController) GenerateVariants(id string) (model.ProductVariantList, error) {
+	if err := pc.authorize(id); err != nil {
+		return model.ProductVariantList{}, err
+	}
+
+	product, err := pc.repo.GetProduct(id)
+	if err != nil {
+		return model.ProductVariantList{}, err
+	}
+	if product == nil {
+		return model.ProductVariantList{}, utils.NotFound()
+	}
+
+	options, err := pc.options(id)
+	if err != nil {
+		return model.ProductVariantList{}, err
+	}
+	groups := groupOptions(options)
+
+	combinations := 1
+	for _, g := range groups {
+		combinations *= len(g.Options)
+		if combinations > model.MaxVariants {
+			return model.ProductVariantList{}, utils.InvalidRequest(fmt.Sprintf("the option groups combine into more than %d variants", model.MaxVariants))
+		}
+	}
+
+	existing, err := pc.repo.ListVariants(id)
+	if err != nil {
+		return model.ProductVariantList{}, err
+	}
+
+	// Find the variants which can no longer be chosen
+	groupOf := make(map[string]string, len(options))
+	for _, g := range groups {
+		for _, o := range g.Options {
+			groupOf[o.ID] = g.Name
+		}
+	}
+	combined := make(map[string]bool, len(existing))
+	taken := make(map[string]bool, len(existing))
+	var disable []string
+	for _, v := range existing {
+		combined[v.OptionIDs.String()] = true
+		taken[v.Sku] = true
+		if v.Enabled && !chosenFromEach(v.OptionIDs, groupOf, len(groups)) {
+			disable = append(disable, v.ID)
+		}
+	}
+
+	var created []model.ProductVariant
+	if len(groups) > 0 {
+		for _, combination := range combine(groups) {
+			ids := make([]string, 0, len(combination))
+			for _, o := range combination {
+				ids = append(ids, o.ID)
+			}
+			optionIDs := model.NewIDList(ids)
+			if combined[optionIDs.String()] {
+				continue
+			}
+
+			price, clash := model.Adjust(product.Price, model.PriceAdjustments(combination))
+			if clash != "" {
+				return model.ProductVariantList{}, utils.InvalidRequest("option " + clash + " overrides the price which another option of the combination already overrides")
+			}
+
+			created = append(created, model.ProductVariant{
+				ID:        utils.GenerateUUID(),
+				ProductID: id,
+				Sku:       sku(id, combination, taken),
+				OptionIDs: optionIDs,
+				Price:     price,
+				Enabled:   true,
+			})
+		}
+	}
+
+	// Disabling and adding happen together, so a failure leaves the variants as they were
+	if len(disable) > 0 || len(created) > 0 {
+		if err = pc.repo.GenerateVariants(id, disable, created); err != nil {
+			return model.ProductVariantList{}, translate(err)
+		}
+	}
+
+	return pc.ListVariants(id)
+}
+
+func (pc *ProductController) GetVariant(id string, variantId string) (*model.ProductVariant, error) {
+	return pc.repo.GetVariant(id, variantId)
+}
+
+func (pc *ProductController) UpdateVariant(id string, variantId string, variant *model.ProductVariant) error {
+	if err := pc.authorize(id); err != nil {
+		return err
+	}
+
+	return translate(pc.repo.UpdateVariant(id, variantId, variant))
+}
+
+func (pc *ProductController) DeleteVariant(id string, variantId string) error {
+	if err := pc.authorize(id); err != nil {
+		return err
+	}
+
+	return translate(pc.repo.DeleteVariant(id, variantId))
+}
+
+// exists returns a not found error when the product does not exist
+func (pc *ProductController) exists(id string) error {
+	product, err := pc.repo.GetProduct(id)
+	if err != nil {
+		return err
+	}
+	if product == nil {
+		return utils.NotFound()
+	}
+
+	return nil
+}
+
+// options returns every option of a product ordered by name
+// The options are listed page by page, a single page would leave those past the limit out
+func (pc *ProductController) options(id string) ([]model.ProductOption, error) {
+	if err := pc.exists(id); err != nil {
+		return nil, err
+	}
+
+	var options []model.ProductOption
+	q := model.OptionQuery{Sort: model.Sort{Field: "Name"}, Page: model.Page{Limit: model.MaxLimit}}
+	for {
+		page, total, err := pc.repo.ListOptions(id, q)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, page...)
+		if len(page) == 0 || len(options) >= total {
+			return options, nil
+		}
+		q.Page.Offset += len(page)
+	}
+}
+
+// chosenFromEach reports whether the options are exactly one option of each of the groups,
+// given the group of every grouped option
+func chosenFromEach(optionIDs model.IDList, groupOf map[string]string, groups int) bool {
+	if len(optionIDs) != groups {
+		return false
+	}
+
+	seen := make(map[string]bool, groups)
+	for _, optionID := range optionIDs {
+		group, ok := groupOf[optionID]
+		if !ok || seen[group] {
+			return false
+		}
+		seen[group] = true
+	}
+
+	return true
+}
+
+// groupOptions collects the options by group, leaving out the add-ons without one
+func groupOptions(options []model.ProductOption) []model.OptionGroup {
+	var groups []model.OptionGroup
+	index := map[string]int{}
+	for _, o := range options {
+		if o.Group == "" {
+			continue
+		}
+		i, ok := index[o.Group]
+		if !ok {
+			i = len(groups)
+			index[o.Group] = i
+			groups = append(groups, model.OptionGroup{Name: o.Group})
+		}
+		groups[i].Options = append(groups[i].Options, o)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+
+	return groups
+}
+
+// combine returns every combination of one option from each group
+func combine(groups []model.OptionGroup) [][]model.ProductOption {
+	combinations := [][]model.ProductOption{nil}
+	for _, g := range groups {
+		var next [][]model.ProductOption
+		for _, c := range combinations {
+			for _, o := range g.Options {
+				next = append(next, append(append([]model.ProductOption(nil), c...), o))
+			}
+		}
+		combinations = next
+	}
+
+	return combinations
+}
+
+// sku builds a readable SKU out of the product ID and the option names, like 07AAC771-L-RED
+// A number is appended when the code is already taken
+func sku(productID string, combination []model.ProductOption, taken map[string]bool) string {
+	parts := []string{productID[:8]}
+	for _, o := range combination {
+		code := strings.Map(func(r rune) rune {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return unicode.ToUpper(r)
+			}
+			return -1
+		}, o.Name)
+		if len(code) > 6 {
+			code = code[:6]
+		}
+		if code == "" {
+			code = o.ID[:4]
+		}
+		parts = append(parts, code)
+	}
+
+	base := strings.Join(parts, "-")
+	code := base
+	for n := 2; taken[code]; n++ {
+		code = fmt.Sprintf("%s-%d", base, n)
+	}
+	taken[code] = true
+
+	return code
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"../model"
+	"../storage"
+	"../utils"
+	"testing"
+)
+
+// TestGenerateVariantsAfterAddingAGroup checks the variants made before a group was added are
+// disabled, leaving only the full combinations enabled
+func TestGenerateVariantsAfterAddingAGroup(t *testing.T) {
+	repo := storage.NewMemoryRepository()
+	product := model.Product{ID: utils.GenerateUUID(), Name: "Shirt", Price: 10000}
+	if err := repo.CreateProduct(&product); err != nil {
+		t.Fatal(err)
+	}
+	pc := NewProductController(repo, model.Pricing{Currency: "USD"})
+
+	size := model.OptionGroup{Name: "Size", Options: []model.ProductOption{{Name: "S"}, {Name: "M"}}}
+	if err := pc.CreateGroup(product.ID, &size); err != nil {
+		t.Fatal(err)
+	}
+	before, err := pc.GenerateVariants(product.ID)
+	if err != nil || len(before.Items) != 2 {
+		t.Fatalf("generate variants of one group: %v %v", before.Items, err)
+	}
+
+	colour := model.OptionGroup{Name: "Colour", Options: []model.ProductOption{{Name: "Red"}, {Name: "Blue"}}}
+	if err = pc.CreateGroup(product.ID, &colour); err != nil {
+		t.Fatal(err)
+	}
+	after, err := pc.GenerateVariants(product.ID)
+	if err != nil || len(after.Items) != 6 {
+		t.Fatalf("generate variants of two groups: %v %v", after.Items, err)
+	}
+
+	enabled := 0
+	for _, v := range after.Items {
+		if v.Enabled {
+			enabled++
+			if len(v.OptionIDs) != 2 {
+				t.Fatalf("variant %s missing a group is enabled", v.Sku)
+			}
+		}
+	}
+	if enabled != 4 {
+		t.Fatalf("%d variants enabled, expected 4", enabled)
+	}
+}
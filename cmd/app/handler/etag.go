@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"../utils"
+	"github.com/labstack/echo"
+	"strconv"
+	"strings"
+)
+
+// Conditional request support
+// Products and options are served with an ETag made of their version, writes
+// name the version they change with If-Match and reads skip a representation
+// the client already holds with If-None-Match
+
+// Headers of conditional requests, which the framework has no names for
+const (
+	HeaderETag        = "ETag"
+	HeaderIfMatch     = "If-Match"
+	HeaderIfNoneMatch = "If-None-Match"
+)
+
+// etag formats a version as a strong entity tag
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// setETag tags the response with the version it represents
+func setETag(c echo.Context, version int) {
+	c.Response().Header().Set(HeaderETag, etag(version))
+}
+
+// ifMatch reads the version a write expects from If-Match, 0 standing for any version
+// Weak or unknown tags can never match, so they fail the precondition
+func (h *Handler) ifMatch(c echo.Context) (int, error) {
+	header := strings.TrimSpace(c.Request().Header.Get(HeaderIfMatch))
+	if header == "" {
+		if h.requireIfMatch {
+			return 0, utils.PreconditionRequired("send the ETag of the version being changed in If-Match")
+		}
+		return 0, nil
+	}
+	if header == "*" {
+		return 0, nil
+	}
+	if strings.Contains(header, ",") {
+		return 0, utils.InvalidRequest("If-Match has to hold a single ETag or *")
+	}
+
+	version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(header, `"`), `"`))
+	if err != nil || version < 1 || header != etag(version) {
+		return 0, utils.PreconditionFailed("If-Match does not name a version of the resource")
+	}
+
+	return version, nil
+}
+
+// notModified tags the response with the version it represents and reports whether
+// If-None-Match shows the client already holds it, comparing the tags weakly
+func notModified(c echo.Context, version int) bool {
+	setETag(c, version)
+
+	header := c.Request().Header.Get(HeaderIfNoneMatch)
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag(version) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,16 +1,35 @@
 package handler
 
-import "../product"
+import (
+	"../product"
+	"../utils"
+	"github.com/labstack/echo"
+)
 
 // Main service handler container to hold interfaces
 // To backend logic
 type Handler struct {
 	productFront product.Front
+
+	// Refuse writes to products and options which do not name a version with If-Match
+	requireIfMatch bool
+}
+
+// Options tune how the handlers treat requests
+type Options struct {
+	RequireIfMatch bool
 }
 
 // Constructor for handler, allows for a controller to be introduced to it
-func NewHandler(pf product.Front) *Handler {
+func NewHandler(pf product.Front, opts Options) *Handler {
 	return &Handler{
-		productFront: pf,
+		productFront:   pf,
+		requireIfMatch: opts.RequireIfMatch,
 	}
 }
+
+// front returns the backend logic acting on behalf of the authenticated caller of the request
+func (h *Handler) front(c echo.Context) product.Front {
+	caller, _ := c.Get(utils.PrincipalKey).(*utils.Principal)
+	return h.productFront.As(caller)
+}
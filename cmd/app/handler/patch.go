@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"../model"
+	"../utils"
+	"encoding/json"
+	"github.com/labstack/echo"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+// Patch specific handler specification
+// Products and options take JSON merge patches and JSON patches, applied to
+// the resource in the shape of its request payload, so a patched resource
+// is validated by the same rules as a replaced one
+
+// Patch a product applies a merge patch or JSON patch to an existing product
+// return error
+// Router /products/{id} [patch]
+func (h *Handler) Patch(c echo.Context) error {
+
+	productId := c.Param("id")
+
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Read the version the patch is meant for
+	version, err := h.ifMatch(c)
+	if err != nil {
+		return err
+	}
+
+	// Pick the way the patch applies from its media type
+	apply, err := readPatch(c)
+	if err != nil {
+		return err
+	}
+
+	// Run the controller to patch the stored product, only on the version named by If-Match
+	product, err := h.front(c).PatchProduct(productId, version, func(product *model.Product) error {
+		doc, err := json.Marshal(productPayload(product))
+		if err != nil {
+			return err
+		}
+		if doc, err = apply(doc); err != nil {
+			return err
+		}
+
+		var rp ProductRequestPayload
+		if err = json.Unmarshal(doc, &rp); err != nil {
+			return utils.InvalidRequest("the patched product does not fit the payload: " + err.Error())
+		}
+
+		return validateProduct(rp, product)
+	})
+
+	// Check for processing error
+	if err != nil {
+
+		// Not found, changed in the meantime, invalid or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with the patched product and its tag
+	setETag(c, product.Version)
+	return c.JSONPretty(http.StatusOK, product, " ")
+}
+
+// Patch an option of a product applies a merge patch or JSON patch to a specific option
+// return error
+// Router /products/{id}/options/{optionId} [patch]
+func (h *Handler) PatchAnOption(c echo.Context) error {
+
+	// Grab incoming ID
+	productId := c.Param("id")
+	optionId := c.Param("optionId")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) || !utils.IsValidUUID(optionId) {
+		return utils.InvalidID()
+	}
+
+	// Read the version the patch is meant for
+	version, err := h.ifMatch(c)
+	if err != nil {
+		return err
+	}
+
+	// Pick the way the patch applies from its media type
+	apply, err := readPatch(c)
+	if err != nil {
+		return err
+	}
+
+	// Run the controller to patch the stored option, only on the version named by If-Match
+	productOption, err := h.front(c).PatchSpecificOption(productId, optionId, version, func(option *model.ProductOption) error {
+		doc, err := json.Marshal(optionPayload(option))
+		if err != nil {
+			return err
+		}
+		if doc, err = apply(doc); err != nil {
+			return err
+		}
+
+		var rpo ProductOptionRequestPayload
+		if err = json.Unmarshal(doc, &rpo); err != nil {
+			return utils.InvalidRequest("the patched option does not fit the payload: " + err.Error())
+		}
+
+		return validateProductOption(rpo, option)
+	})
+
+	// Check for processing error
+	if err != nil {
+
+		// Return issues
+		return err
+	}
+
+	// All good respond with the patched option and its tag
+	setETag(c, productOption.Version)
+	return c.JSONPretty(http.StatusOK, productOption, " ")
+}
+
+// readPatch reads the patch of the request and returns the function applying it to a document
+// Media types other than the merge patch and the JSON patch are unsupported
+func readPatch(c echo.Context) (func(doc []byte) ([]byte, error), error) {
+	mediaType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil || (mediaType != utils.MIMEMergePatch && mediaType != utils.MIMEJSONPatch) {
+		return nil, echo.NewHTTPError(http.StatusUnsupportedMediaType,
+			"a patch has to be sent as "+utils.MIMEMergePatch+" or "+utils.MIMEJSONPatch)
+	}
+
+	patch, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if mediaType == utils.MIMEJSONPatch {
+		return func(doc []byte) ([]byte, error) { return utils.JSONPatch(doc, patch) }, nil
+	}
+	return func(doc []byte) ([]byte, error) { return utils.MergePatch(doc, patch) }, nil
+}
+
+// productPayload presents a product in the shape of its request payload, the document a patch applies to
+func productPayload(product *model.Product) ProductRequestPayload {
+	rp := ProductRequestPayload{
+		ID:            product.ID,
+		Name:          product.Name,
+		Description:   product.Description,
+		Price:         json.Number(product.Price.String()),
+		DeliveryPrice: json.Number(product.DeliveryPrice.String()),
+		Team:          product.Team,
+		Prices:        []PriceRequestPayload{},
+	}
+	for _, p := range product.Prices {
+		rp.Prices = append(rp.Prices, PriceRequestPayload{
+			Currency:      p.Currency,
+			Price:         json.Number(p.Price.String()),
+			DeliveryPrice: json.Number(p.DeliveryPrice.String()),
+		})
+	}
+
+	return rp
+}
+
+// optionPayload presents an option in the shape of its request payload, the document a patch applies to
+func optionPayload(option *model.ProductOption) ProductOptionRequestPayload {
+	return ProductOptionRequestPayload{
+		ID:                      option.ID,
+		ProductID:               option.ProductID,
+		Name:                    option.Name,
+		Description:             option.Description,
+		Group:                   option.Group,
+		PriceMode:               option.PriceMode,
+		PriceAdjustment:         json.Number(option.PriceAdjustment.String()),
+		DeliveryPriceMode:       option.DeliveryPriceMode,
+		DeliveryPriceAdjustment: json.Number(option.DeliveryPriceAdjustment.String()),
+	}
+}
@@ -3,7 +3,6 @@ package handler
 import (
 	"../model"
 	"../utils"
-	"errors"
 	"github.com/labstack/echo"
 	"net/http"
 )
@@ -12,72 +11,123 @@ import (
 // All product related handlers are defined and
 // managed in here
 
-// Get product handler retrieves all products
+// Get product handler retrieves one page of products
 // returns an error
-// Router /products or /products?name={} [get]
+// Router /products or /products?name={}&q={}&match={}&in={}&{field}[{op}]={}&limit={}&offset={}&cursor={}&sort={}&currency={}&status={} [get]
 func (h *Handler) Get(c echo.Context) (err error) {
 
 	// Prepare model
 	var productList model.ProductList
 
-	// TODO: Check if the query parameter exists at all
+	// Read the search, if any
+	search, err := h.parseSearch(c)
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
+	}
 
-	// Get query parameter name
-	name := c.QueryParam("name")
+	// Read the filter conditions
+	filter, err := h.parseFilter(c, model.ProductFilterFields, model.ProductFilterAliases)
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
+	}
 
-	// Check if a name was given
-	if len(name) > 0 {
-		// List products by name
-		productList, err = h.productFront.ListByName(name)
-	} else {
-		// List all products
-		productList, err = h.productFront.List()
+	// Full-text results can also be ordered by relevance
+	sortFields := model.ProductSortFields
+	if search != nil && search.Mode == model.SearchFullText {
+		sortFields = make(map[string]string, len(model.ProductSortFields)+1)
+		for k, v := range model.ProductSortFields {
+			sortFields[k] = v
+		}
+		sortFields["relevance"] = model.SortRelevance
 	}
 
-	// Check if any results came back
-	if len(productList.Items) == 0 {
+	// Read the paging and sort order
+	sort, page, err := h.parsePaging(c, sortFields)
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
+	}
 
-		// 404 nothing found
-		return c.JSONPretty(http.StatusNotFound, utils.NotFound(), " ")
+	// Read the currency to price the products in
+	currency, err := h.parseCurrency(c)
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
 	}
 
+	// Read the statuses to list, only published products unless asked otherwise
+	statuses, err := h.parseStatuses(c)
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
+	}
+
+	// Rank full-text results unless another order was asked for
+	if _, ok := sortFields["relevance"]; ok && sort.Field == "" && page.Cursor == nil && c.QueryParam("sort") == "" {
+		sort = model.Sort{Field: model.SortRelevance, Desc: true}
+	}
+
+	// Get query parameter name, an empty name lists all products
+	name := c.QueryParam("name")
+
+	// List the requested page of products
+	productList, err = h.front(c).List(model.ProductQuery{Name: name, Search: search, Filter: filter, Sort: sort, Page: page, Currency: currency, Statuses: statuses})
+
 	// Check if any error got thrown during processing
 	if err != nil {
 
 		// Format error for response
-		return c.JSONPretty(http.StatusInternalServerError, utils.NewError(err), " ")
+		return err
 	}
 
+	// Check if anything matched at all
+	if productList.Meta.Total == 0 {
+
+		// 404 nothing found
+		return utils.NotFound()
+	}
+
+	// Link the neighbouring pages
+	productList.Meta.Links = h.pageLinks(c, productList.Meta)
+
 	// All good respond with results
 	return c.JSONPretty(http.StatusOK, &productList, " ")
 }
 
 // Get product by the given product ID
 // return error
-// Router /products/{id} [get]
+// Router /products/{id} or /products/{id}?currency={} [get]
 func (h *Handler) GetByID(c echo.Context) error {
 
 	productId := c.Param("id")
 
 	if !utils.IsValidUUID(productId) {
-		return c.JSONPretty(http.StatusConflict, utils.NewError(errors.New("Invalid UUID")), " ")
+		return utils.InvalidID()
+	}
+
+	// Read the currency to price the product in
+	currency, err := h.parseCurrency(c)
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
 	}
 
 	// Run controller to pull results
-	product, err := h.productFront.GetByID(productId)
+	product, err := h.front(c).GetByID(productId, currency)
+
+	// Check for processing error
+	if err != nil {
+
+		// Format error for response
+		return err
+	}
 
 	// Check if anything came back
 	if product == nil {
 
 		// If empty response 404
-		return c.JSONPretty(http.StatusNotFound, utils.NotFound(), " ")
+		return utils.NotFound()
 	}
 
-	// Check for processing error
-	if err != nil {
-
-		// Format error for response
-		return c.JSONPretty(http.StatusInternalServerError, utils.NewError(err), " ")
+	// Spare the body when the client holds this version already
+	if notModified(c, product.Version) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
 	// All good respond with results
@@ -92,24 +142,19 @@ func (h *Handler) Add(c echo.Context) (err error) {
 	// Get model
 	product := model.Product{}
 
+	// Bind and validate the payload, bail out with every violation found
 	if err = h.ValidateProductPayload(c, &product); err != nil {
-		return c.JSONPretty(http.StatusConflict, utils.NewError(err), " ")
-	}
-
-	// Check for binding issues to bail out
-	if err != nil {
-		// Return a conflict status
-		return c.JSON(http.StatusConflict, utils.NewError(err))
+		return err
 	}
 
 	// Proceed to create product with controller
-	err = h.productFront.CreateProduct(&product)
+	err = h.front(c).CreateProduct(&product)
 
 	// Check for processing errors
 	if err != nil {
 
-		// Return formatted response
-		return c.JSON(http.StatusConflict, utils.NewError(err))
+		// Hand over to the error handler
+		return err
 	}
 
 	// All good respond
@@ -124,33 +169,36 @@ func (h *Handler) Update(c echo.Context) (err error) {
 	productId := c.Param("id")
 
 	if !utils.IsValidUUID(productId) {
-		return c.JSONPretty(http.StatusConflict, utils.NewError(errors.New("Invalid UUID")), " ")
+		return utils.InvalidID()
+	}
+
+	// Read the version the update is meant for
+	version, err := h.ifMatch(c)
+	if err != nil {
+		return err
 	}
 
 	// Instantiate a model with incoming product ID
 	product := model.Product{ID: productId}
 
-	// Bind the payload to the model
-	err = c.Bind(&product)
-
-	// Check for binding error
-	if err != nil {
-
-		// Response with conflict stating the issue
-		return c.JSON(http.StatusConflict, utils.NewError(err))
+	// Bind and validate the whole replacement, fields left out are cleared
+	if err = h.ValidateProductPayload(c, &product); err != nil {
+		return err
 	}
 
-	// Run the controller for update
-	err = h.productFront.UpdateProduct(&product)
+	// Run the controller for update, only on the version named by If-Match
+	product.Version = version
+	err = h.front(c).UpdateProduct(&product)
 
 	// Check for processing error
 	if err != nil {
 
-		// Return conflicts
-		return c.JSON(http.StatusConflict, utils.NewError(err))
+		// Not found, changed in the meantime or internal, the error handler decides
+		return err
 	}
 
-	// All good respond
+	// All good respond with the tag of the new version
+	setETag(c, product.Version)
 	return c.JSONPretty(http.StatusOK, map[string]interface{}{"result": "ok"}, " ")
 }
 
@@ -167,29 +215,121 @@ func (h *Handler) Delete(c echo.Context) (err error) {
 
 	// Validate ID
 	if !utils.IsValidUUID(productId) {
-		return c.JSONPretty(http.StatusConflict, utils.NewError(errors.New("Invalid UUID")), " ")
+		return utils.InvalidID()
+	}
+
+	// Read the version the delete is meant for
+	product.Version, err = h.ifMatch(c)
+	if err != nil {
+		return err
 	}
 
 	// Get incoming product id
 	product.ID = productId
 
 	// Get controller to run delete
-	err = h.productFront.DeleteProduct(&product)
+	err = h.front(c).DeleteProduct(&product)
 
 	// Check for processing error
 	if err != nil {
 
-		// Response issue with correct code
-		return c.JSON(http.StatusConflict, utils.NewError(err))
+		// The error handler responds with the correct code
+		return err
 	}
 
 	// All good response
 	return c.JSONPretty(http.StatusOK, map[string]interface{}{"result": "ok"}, " ")
 }
 
-// Get product options retrieves the options of a product
+// Publish a product lists a draft product
+// return error
+// Router /products/{id}/publish [post]
+func (h *Handler) Publish(c echo.Context) error {
+	return h.transition(c, "publish")
+}
+
+// Archive a product takes a published product out of the listing
+// return error
+// Router /products/{id}/archive [post]
+func (h *Handler) Archive(c echo.Context) error {
+	return h.transition(c, "archive")
+}
+
+// Restore a product brings an archived product back as a draft
+// return error
+// Router /products/{id}/restore [post]
+func (h *Handler) Restore(c echo.Context) error {
+	return h.transition(c, "restore")
+}
+
+// transition takes the named lifecycle action on a product
+func (h *Handler) transition(c echo.Context, action string) error {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to move the product on, the controller checks the transition is allowed
+	product, err := h.front(c).Transition(productId, action)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not found, not allowed from the current status or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with the product in its new status
+	setETag(c, product.Version)
+	return c.JSONPretty(http.StatusOK, product, " ")
+}
+
+// Get the price of a product works out what it costs with a chosen set of options
+// return error
+// Router /products/{id}/price?options={optionId},{optionId}&currency={} [get]
+func (h *Handler) GetPrice(c echo.Context) error {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Read the chosen options, given once comma separated or repeated
+	optionIds, err := h.parseOptionIDs(c)
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
+	}
+
+	// Read the currency to price the product in
+	currency, err := h.parseCurrency(c)
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
+	}
+
+	// Run controller to work out the price
+	price, err := h.front(c).EffectivePrice(productId, optionIds, currency)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not found, clashing options or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with results
+	return c.JSONPretty(http.StatusOK, price, " ")
+}
+
+// Get product options retrieves one page of the options of a product
 // return error
-// Router /products/{id}/options [get]
+// Router /products/{id}/options?{field}[{op}]={}&limit={}&offset={}&cursor={}&sort={} [get]
 func (h *Handler) GetOptions(c echo.Context) (err error) {
 
 	// Grab incoming product id
@@ -197,29 +337,44 @@ func (h *Handler) GetOptions(c echo.Context) (err error) {
 
 	// Validate ID
 	if !utils.IsValidUUID(productId) {
-		return c.JSONPretty(http.StatusConflict, utils.NewError(errors.New("Invalid UUID")), " ")
+		return utils.InvalidID()
+	}
+
+	// Read the filter conditions
+	filter, err := h.parseFilter(c, model.OptionFilterFields, nil)
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
+	}
+
+	// Read the paging and sort order
+	sort, page, err := h.parsePaging(c, model.OptionSortFields)
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
 	}
 
 	// Model
 	var productOptionsList model.ProductOptionList
 
 	// Run the controller function and hydrate the model
-	productOptionsList, err = h.productFront.ListOptions(productId)
-
-	// Check if any results came back
-	if len(productOptionsList.Items) == 0 {
-
-		// 404 nothing found
-		return c.JSONPretty(http.StatusNotFound, utils.NotFound(), " ")
-	}
+	productOptionsList, err = h.front(c).ListOptions(productId, model.OptionQuery{Filter: filter, Sort: sort, Page: page})
 
 	// check for processing errors
 	if err != nil {
 
 		// Return issues
-		return c.JSONPretty(http.StatusInternalServerError, utils.NewError(err), " ")
+		return err
 	}
 
+	// Check if the product has any options at all
+	if productOptionsList.Meta.Total == 0 {
+
+		// 404 nothing found
+		return utils.NotFound()
+	}
+
+	// Link the neighbouring pages
+	productOptionsList.Meta.Links = h.pageLinks(c, productOptionsList.Meta)
+
 	// All good response with results
 	return c.JSONPretty(http.StatusOK, &productOptionsList, " ")
 }
@@ -235,24 +390,29 @@ func (h *Handler) GetAnOption(c echo.Context) error {
 
 	// Validate IDs
 	if !utils.IsValidUUID(productId) || !utils.IsValidUUID(optionId) {
-		return c.JSONPretty(http.StatusConflict, utils.NewError(errors.New("Invalid UUID")), " ")
+		return utils.InvalidID()
 	}
 
 	// Run controller with filters to retrieve results and populate model
-	productOption, err := h.productFront.GetSpecificOption(productId, optionId)
+	productOption, err := h.front(c).GetSpecificOption(productId, optionId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Notify about error
+		return err
+	}
 
 	// If the model didn't get populated
 	if productOption == nil {
 
 		// No is found with specification 404
-		return c.JSONPretty(http.StatusNotFound, utils.NotFound(), " ")
+		return utils.NotFound()
 	}
 
-	// Check for processing error as well
-	if err != nil {
-
-		// Notify about error
-		return c.JSONPretty(http.StatusInternalServerError, utils.NewError(err), " ")
+	// Spare the body when the client holds this version already
+	if notModified(c, productOption.Version) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
 	// All good response with results
@@ -270,19 +430,19 @@ func (h *Handler) AddAnOption(c echo.Context) (err error) {
 	// Prepare a model with relevant product ID
 	productOption := model.ProductOption{ProductID: productId}
 
+	// Bind and validate the payload, bail out with every violation found
 	if err = h.ValidateProductOptionPayload(c, &productOption); err != nil {
-		return c.JSONPretty(http.StatusConflict, utils.NewError(err), " ")
+		return err
 	}
 
 	// Inject model into controller to create
-	err = h.productFront.CreateOption(&productOption)
+	err = h.front(c).CreateOption(&productOption)
 
 	// Check for creation error
 	if err != nil {
 
-		// Return issue
-		// TODO: Need to decide on the type of error response to be specific
-		return c.JSON(http.StatusConflict, utils.NewError(err))
+		// Hand over to the error handler
+		return err
 	}
 
 	// All good response
@@ -300,33 +460,36 @@ func (h *Handler) UpdateAnOption(c echo.Context) (err error) {
 
 	// Validate ID
 	if !utils.IsValidUUID(productId) || !utils.IsValidUUID(optionId) {
-		return c.JSONPretty(http.StatusConflict, utils.NewError(errors.New("Invalid UUID")), " ")
+		return utils.InvalidID()
 	}
 
-	// Prepare a model
-	productOption := model.ProductOption{}
-
-	// Bind incoming payload with model
-	err = c.Bind(&productOption)
-
-	// Check for binding errors
+	// Read the version the update is meant for
+	version, err := h.ifMatch(c)
 	if err != nil {
+		return err
+	}
 
-		// Return issues
-		return c.JSON(http.StatusConflict, utils.NewError(err))
+	// Prepare a model
+	productOption := model.ProductOption{ID: optionId, ProductID: productId}
+
+	// Bind and validate the whole replacement, fields left out are cleared
+	if err = h.ValidateProductOptionPayload(c, &productOption); err != nil {
+		return err
 	}
 
-	// Run controller function to update using filters
-	err = h.productFront.UpdateSpecificOption(productId, optionId, &productOption)
+	// Run controller function to update using filters, only on the version named by If-Match
+	productOption.Version = version
+	err = h.front(c).UpdateSpecificOption(productId, optionId, &productOption)
 
 	// Check for controller processing errors
 	if err != nil {
 
 		// Return issues
-		return c.JSON(http.StatusConflict, utils.NewError(err))
+		return err
 	}
 
-	// All good response
+	// All good response with the tag of the new version
+	setETag(c, productOption.Version)
 	return c.JSONPretty(http.StatusOK, map[string]interface{}{"result": "ok"}, " ")
 }
 
@@ -341,17 +504,23 @@ func (h *Handler) DeleteAnOption(c echo.Context) (err error) {
 
 	// Validate IDs
 	if !utils.IsValidUUID(productId) || !utils.IsValidUUID(optionId) {
-		return c.JSONPretty(http.StatusConflict, utils.NewError(errors.New("Invalid UUID")), " ")
+		return utils.InvalidID()
+	}
+
+	// Read the version the delete is meant for
+	version, err := h.ifMatch(c)
+	if err != nil {
+		return err
 	}
 
 	// Run controller function with filters
-	err = h.productFront.DeleteSpecificOption(productId, optionId)
+	err = h.front(c).DeleteSpecificOption(productId, optionId, version)
 
 	// Check for processing error
 	if err != nil {
 
 		// Return issues
-		return c.JSON(http.StatusConflict, utils.NewError(err))
+		return err
 	}
 
 	// All good response
@@ -0,0 +1,349 @@
+package handler
+
+import (
+	"../model"
+	"../utils"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query parameter handling for listings
+// Supports ?limit=&offset= and ?limit=&cursor= paging together with
+// ?sort=field or ?sort=-field for descending order, and product search with
+// ?q=term&match=exact|prefix|contains|fulltext&in=name,description
+// Filters are written as ?field[op]=value, e.g. ?price[gte]=10, or with named shortcuts like ?minPrice=10
+// Prices are read in another currency with ?currency=EUR
+
+// parsePaging reads the paging and sort query parameters
+// fields holds the sortable fields keyed by their lower cased name
+func (h *Handler) parsePaging(c echo.Context, fields map[string]string) (model.Sort, model.Page, error) {
+	var sort model.Sort
+	var page model.Page
+
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > model.MaxLimit {
+			return sort, page, fmt.Errorf("limit must be a number between 1 and %d", model.MaxLimit)
+		}
+		page.Limit = limit
+	}
+
+	if v := c.QueryParam("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return sort, page, errors.New("offset must be a positive number")
+		}
+		page.Offset = offset
+	}
+
+	sortParam := c.QueryParam("sort")
+	if sortParam != "" {
+		sort.Desc = strings.HasPrefix(sortParam, "-")
+		field, ok := fields[strings.ToLower(strings.TrimPrefix(sortParam, "-"))]
+		if !ok {
+			return sort, page, fmt.Errorf("sort field %q is not supported", strings.TrimPrefix(sortParam, "-"))
+		}
+		sort.Field = field
+
+		// The best matches always come first
+		if field == model.SortRelevance {
+			sort.Desc = true
+		}
+	}
+
+	if v := c.QueryParam("cursor"); v != "" {
+		if page.Offset > 0 {
+			return sort, page, errors.New("cursor and offset cannot be combined")
+		}
+
+		cursor, err := model.DecodeCursor(v)
+		if err != nil {
+			return sort, page, err
+		}
+
+		// The cursor carries its sort order, an explicit one has to agree with it
+		if sortParam == "" {
+			sort = model.Sort{Field: cursor.Field, Desc: cursor.Desc}
+		}
+		if cursor.Field != sort.Field || cursor.Desc != sort.Desc || !isSortField(fields, cursor.Field) {
+			return sort, page, errors.New("cursor does not match the sort order")
+		}
+		page.Cursor = cursor
+	}
+
+	return sort, page, nil
+}
+
+// parseSearch reads the search term along with its mode and the fields to search in
+// Returns nil when no term is given, full-text matching over all fields is the default
+func (h *Handler) parseSearch(c echo.Context) (*model.Search, error) {
+	term := strings.TrimSpace(c.QueryParam("q"))
+	if term == "" {
+		return nil, nil
+	}
+
+	s := &model.Search{Term: term, Mode: model.SearchFullText}
+
+	if v := c.QueryParam("match"); v != "" {
+		switch mode := strings.ToLower(v); mode {
+		case model.SearchExact, model.SearchPrefix, model.SearchContains, model.SearchFullText:
+			s.Mode = mode
+		default:
+			return nil, fmt.Errorf("match %q must be one of exact, prefix, contains, fulltext", v)
+		}
+	}
+
+	if v := c.QueryParam("in"); v != "" {
+		for _, name := range strings.Split(v, ",") {
+			field, ok := model.ProductSearchFields[strings.ToLower(strings.TrimSpace(name))]
+			if !ok {
+				return nil, fmt.Errorf("search field %q is not supported", name)
+			}
+			if !containsString(s.Fields, field) {
+				s.Fields = append(s.Fields, field)
+			}
+		}
+	}
+
+	if s.Mode == model.SearchFullText && strings.IndexFunc(term, isWordRune) < 0 {
+		return nil, errors.New("q needs at least one word to search for")
+	}
+
+	return s, nil
+}
+
+// parseCurrency reads the currency prices are wanted in, empty for the default one
+func (h *Handler) parseCurrency(c echo.Context) (string, error) {
+	v := c.QueryParam("currency")
+	if v == "" {
+		return "", nil
+	}
+
+	currency := strings.ToUpper(v)
+	if !model.IsCurrency(currency) {
+		return "", fmt.Errorf("currency %q is not an ISO 4217 currency code", v)
+	}
+
+	return currency, nil
+}
+
+// parseStatuses reads the statuses products are listed in, published ones by default
+// A comma separated list of statuses, or all of them with all, brings in the other states
+func (h *Handler) parseStatuses(c echo.Context) ([]string, error) {
+	v := c.QueryParam("status")
+	if v == "" {
+		return []string{model.StatusPublished}, nil
+	}
+	if strings.ToLower(v) == "all" {
+		return nil, nil
+	}
+
+	var statuses []string
+	for _, status := range strings.Split(v, ",") {
+		status = strings.ToLower(strings.TrimSpace(status))
+		if !containsString(model.ProductStatuses, status) {
+			return nil, fmt.Errorf("status %q must be one of %s or all", status, strings.Join(model.ProductStatuses, ", "))
+		}
+		if !containsString(statuses, status) {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses, nil
+}
+
+// parseOptionIDs reads the chosen option IDs, dropping repeats
+func (h *Handler) parseOptionIDs(c echo.Context) ([]string, error) {
+	ids := []string{}
+	for _, v := range c.QueryParams()["options"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id == "" {
+				continue
+			}
+			if !utils.IsValidUUID(id) {
+				return nil, fmt.Errorf("option %q is not a valid UUID", id)
+			}
+			if id = strings.ToUpper(id); !containsString(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// filterParam matches the field[op] form of filter query parameters
+var filterParam = regexp.MustCompile(`^([A-Za-z]+)\[([A-Za-z]+)\]$`)
+
+// parseFilter reads the filter conditions out of the query parameters
+// fields holds the filterable fields and aliases the named shortcuts, both keyed by lower cased name
+func (h *Handler) parseFilter(c echo.Context, fields map[string]model.FilterField, aliases map[string]model.FilterAlias) (model.Filter, error) {
+	var filter model.Filter
+	params := c.QueryParams()
+
+	// Go through the parameters in a stable order so errors are reproducible
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var name, op string
+		if m := filterParam.FindStringSubmatch(key); m != nil {
+			name, op = strings.ToLower(m[1]), strings.ToLower(m[2])
+		} else if alias, ok := aliases[strings.ToLower(key)]; ok {
+			name, op = alias.Field, alias.Op
+		} else {
+			continue
+		}
+
+		field, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("filter field %q is not supported", name)
+		}
+		if !containsString(model.FilterOps[field.Kind], op) {
+			return nil, fmt.Errorf("filter operator %q is not supported on %s", op, name)
+		}
+
+		for _, raw := range params[key] {
+			value, err := parseFilterValue(field.Kind, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			filter = append(filter, model.Condition{Field: field.Field, Op: op, Value: value})
+		}
+	}
+
+	return filter, checkBounds(filter)
+}
+
+// parseFilterValue converts the raw value to the type of the field kind
+func parseFilterValue(kind string, raw string) (interface{}, error) {
+	switch kind {
+	case model.FilterNumber:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, errors.New("value must be a number")
+		}
+		return v, nil
+	case model.FilterBool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("value must be true or false")
+		}
+		return v, nil
+	}
+
+	return raw, nil
+}
+
+// checkBounds rejects number ranges which cannot match anything, like minPrice above maxPrice
+func checkBounds(filter model.Filter) error {
+	lower := map[string]float64{}
+	upper := map[string]float64{}
+	for _, c := range filter {
+		v, ok := c.Value.(float64)
+		if !ok {
+			continue
+		}
+		switch c.Op {
+		case model.OpGt, model.OpGte:
+			if cur, seen := lower[c.Field]; !seen || v > cur {
+				lower[c.Field] = v
+			}
+		case model.OpLt, model.OpLte:
+			if cur, seen := upper[c.Field]; !seen || v < cur {
+				upper[c.Field] = v
+			}
+		}
+	}
+
+	for field, lo := range lower {
+		if hi, ok := upper[field]; ok && lo > hi {
+			return fmt.Errorf("%s lower bound %v is above its upper bound %v", field, lo, hi)
+		}
+	}
+
+	return nil
+}
+
+// pageLinks builds the links to the current and neighbouring pages of a listing
+func (h *Handler) pageLinks(c echo.Context, meta *model.ListMeta) model.PageLinks {
+	u := *c.Request().URL
+	links := model.PageLinks{Self: u.RequestURI()}
+	query := u.Query()
+
+	if meta.NextCursor != "" {
+		next := u
+		q := copyQuery(query)
+		q.Del("offset")
+		q.Set("cursor", meta.NextCursor)
+		next.RawQuery = q.Encode()
+		links.Next = next.RequestURI()
+	}
+
+	if query.Get("cursor") == "" && meta.Offset > 0 {
+		prev := u
+		q := copyQuery(query)
+		offset := meta.Offset - meta.Limit
+		if offset > 0 {
+			q.Set("offset", strconv.Itoa(offset))
+		} else {
+			q.Del("offset")
+		}
+		prev.RawQuery = q.Encode()
+		links.Prev = prev.RequestURI()
+	}
+
+	return links
+}
+
+// isSortField reports whether the field can be sorted on, the empty field meaning by Id
+func isSortField(fields map[string]string, field string) bool {
+	if field == "" {
+		return true
+	}
+
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsString reports whether the value is in the list
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isWordRune reports whether the rune can be part of a searchable word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// copyQuery returns a copy of the query values which can be modified freely
+func copyQuery(query url.Values) url.Values {
+	q := make(url.Values, len(query))
+	for k, v := range query {
+		q[k] = append([]string(nil), v...)
+	}
+
+	return q
+}
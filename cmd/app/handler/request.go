@@ -3,84 +3,115 @@ package handler
 import (
 	"../model"
 	"../utils"
-	"errors"
+	"encoding/json"
+	"fmt"
 	"github.com/labstack/echo"
-	"net/http"
 	"regexp"
-	"strconv"
+	"strings"
 )
 
 // Structs for mapping incoming json payload
 type ProductRequestPayload struct {
-	ID            string  `json:"Id"`
-	Name          string  `json:"Name"`
-	Description   string  `json:"Description"`
-	Price         float64 `json:"Price"`
-	DeliveryPrice float64 `json:"DeliveryPrice"`
+	ID            string      `json:"Id,omitempty"`
+	Name          string      `json:"Name"`
+	Description   string      `json:"Description"`
+	Price         json.Number `json:"Price"`
+	DeliveryPrice json.Number `json:"DeliveryPrice"`
+	Status        string      `json:"Status,omitempty"`
+	Team          string      `json:"Team,omitempty"`
+
+	Prices []PriceRequestPayload `json:"Prices"`
+}
+
+type PriceRequestPayload struct {
+	Currency      string      `json:"Currency"`
+	Price         json.Number `json:"Price"`
+	DeliveryPrice json.Number `json:"DeliveryPrice"`
 }
 
 type ProductOptionRequestPayload struct {
-	ID          string `json:"Id"`
-	ProductID   string `json:"ProductId"`
+	ID          string `json:"Id,omitempty"`
+	ProductID   string `json:"ProductId,omitempty"`
 	Name        string `json:"Name"`
 	Description string `json:"Description"`
+	Group       string `json:"Group"`
+
+	PriceMode               string      `json:"PriceMode"`
+	PriceAdjustment         json.Number `json:"PriceAdjustment"`
+	DeliveryPriceMode       string      `json:"DeliveryPriceMode"`
+	DeliveryPriceAdjustment json.Number `json:"DeliveryPriceAdjustment"`
+}
+
+type GroupRequestPayload struct {
+	Name   string   `json:"Name"`
+	Values []string `json:"Values"`
+}
+
+type VariantRequestPayload struct {
+	Sku     string      `json:"Sku"`
+	Price   json.Number `json:"Price"`
+	Enabled *bool       `json:"Enabled"`
+}
+
+// Stock request payload
+type StockRequestPayload struct {
+	OnHand            *int `json:"OnHand"`
+	LowStockThreshold *int `json:"LowStockThreshold"`
+}
+
+// Reservation request payload
+type ReservationRequestPayload struct {
+	OptionId string `json:"OptionId"`
+	Quantity *int   `json:"Quantity"`
 }
 
 // ValidateProductPayload check for the data validity of the json payload values
-// returns error
+// returns error, listing every violation found
 func (h *Handler) ValidateProductPayload(c echo.Context, model *model.Product) error {
-	var err error
-	var msg string
 	var rp ProductRequestPayload
-	err = c.Bind(&rp)
 
 	// Check for binding error
-	if err != nil {
-		return c.JSONPretty(http.StatusInternalServerError, utils.NewError(err), " ")
+	if err := c.Bind(&rp); err != nil {
+		return err
 	}
 
-	// map to model
-	model.ID = rp.ID
+	return validateProduct(rp, model)
+}
+
+// validateProduct checks a product payload and maps it onto the model, which holds the ID of the product
+// The payload may only repeat that ID, a new product has none
+func validateProduct(rp ProductRequestPayload, model *model.Product) error {
 	model.Name = rp.Name
 	model.Description = rp.Description
-	model.Price = rp.Price
-	model.DeliveryPrice = rp.DeliveryPrice
-
-	if len(rp.ID) > 0 {
-		msg = "Id is system generated, please do not supply"
-	}
-
-	if len(rp.Name) < 1 || len(rp.Name) > 17 {
-		msg = "Product Name length should be between 1-17 characters"
-	}
+	model.Team = rp.Team
 
-	if len(rp.Description) > 35 {
-		msg = "Description may be between 1-36 characters"
-	}
-	if err = h.validatePrices(rp.Price, "price"); err != nil {
-		msg = err.Error()
-	}
-	if err = h.validatePrices(rp.DeliveryPrice, "delivery price"); err != nil {
-		msg = err.Error()
+	v := utils.NewValidator()
+	if model.ID == "" {
+		v.Absent("Id", rp.ID, "Id is system generated, please do not supply")
+	} else {
+		v.Check(rp.ID == "" || strings.EqualFold(rp.ID, model.ID), "Id", utils.RuleForbidden, "Id cannot be changed")
 	}
-
-	if len(msg) > 0 {
-		return errors.New(msg)
+	v.Absent("Status", rp.Status, "Status is changed through the publish, archive and restore actions")
+	if v.Required("Name", rp.Name) {
+		v.Length("Name", rp.Name, 1, 17)
 	}
+	v.Length("Description", rp.Description, 0, 35)
+	v.Length("Team", rp.Team, 0, 64)
+	model.Price = price(v, "Price", rp.Price)
+	model.DeliveryPrice = price(v, "DeliveryPrice", rp.DeliveryPrice)
+	model.Prices = prices(v, rp.Prices)
 
-	return nil
+	return v.Err()
 }
 
 // ValidateProductOptionPayload check for the data validity of the json payload values
-// returns error
+// returns error, listing every violation found
 func (h *Handler) ValidateProductOptionPayload(c echo.Context, model *model.ProductOption) error {
-	var msg string
 	var rpo ProductOptionRequestPayload
-	err := c.Bind(&rpo)
 
 	// Check for binding error
-	if err != nil {
-		return c.JSONPretty(http.StatusInternalServerError, utils.NewError(err), " ")
+	if err := c.Bind(&rpo); err != nil {
+		return err
 	}
 
 	// Fix framework assignment issue
@@ -90,42 +121,224 @@ func (h *Handler) ValidateProductOptionPayload(c echo.Context, model *model.Prod
 	// Pass the param product ID
 	rpo.ProductID = model.ProductID
 
-	// Exchange data with model
+	return validateProductOption(rpo, model)
+}
+
+// validateProductOption checks an option payload and maps it onto the model, which holds the IDs of the option
+// The payload may only repeat those IDs, a new option has none of its own
+func validateProductOption(rpo ProductOptionRequestPayload, model *model.ProductOption) error {
 	model.Name = rpo.Name
 	model.Description = rpo.Description
 
-	if len(rpo.ID) > 0 {
-		msg = "Id is system generated, please do not supply"
+	v := utils.NewValidator()
+	if model.ID == "" {
+		v.Absent("Id", rpo.ID, "Id is system generated, please do not supply")
+	} else {
+		v.Check(rpo.ID == "" || strings.EqualFold(rpo.ID, model.ID), "Id", utils.RuleForbidden, "Id cannot be changed")
+	}
+	v.Check(rpo.ProductID == "" || strings.EqualFold(rpo.ProductID, model.ProductID), "ProductId", utils.RuleForbidden, "ProductId cannot be changed")
+	if v.Required("ProductId", model.ProductID) {
+		v.UUID("ProductId", model.ProductID)
+	}
+	if v.Required("Name", rpo.Name) {
+		v.Length("Name", rpo.Name, 1, 17)
 	}
-	if len(rpo.ProductID) == 0 {
-		msg = "Please provide a product id"
+	v.Length("Description", rpo.Description, 0, 35)
+	v.Length("Group", rpo.Group, 0, 17)
+	model.Group = rpo.Group
+	model.PriceMode, model.PriceAdjustment = adjustment(v, "Price", rpo.PriceMode, rpo.PriceAdjustment)
+	model.DeliveryPriceMode, model.DeliveryPriceAdjustment = adjustment(v, "DeliveryPrice", rpo.DeliveryPriceMode, rpo.DeliveryPriceAdjustment)
+
+	return v.Err()
+}
+
+// price reads an amount of the payload, a missing amount is zero
+// Amounts are taken as written, without rounding, and may not be negative
+func price(v *utils.Validator, field string, n json.Number) model.Money {
+	if n == "" {
+		return 0
 	}
-	if !utils.IsValidUUID(rpo.ProductID) {
-		msg = "Product id id not valid UUID"
+
+	m, err := model.ParseMoney(n.String())
+	switch {
+	case err == model.ErrMoneyRange || m < 0:
+		v.Add(field, utils.RuleRange, field+" must be between 0.00 and "+model.MaxMoney.String())
+	case err != nil:
+		v.Add(field, utils.RuleDecimal, field+" "+err.Error())
 	}
-	if len(rpo.Name) < 1 || len(rpo.Name) > 17 {
-		msg = "Product option Name length should be between 1-17 characters"
+
+	return m
+}
+
+// prices reads the explicit prices of the payload, one per currency
+func prices(v *utils.Validator, payload []PriceRequestPayload) []model.ProductPrice {
+	var list []model.ProductPrice
+	seen := make(map[string]bool, len(payload))
+	for i, p := range payload {
+		field := fmt.Sprintf("Prices[%d].", i)
+		list = append(list, model.ProductPrice{
+			Currency:      currency(v, field+"Currency", p.Currency, seen),
+			Price:         price(v, field+"Price", p.Price),
+			DeliveryPrice: price(v, field+"DeliveryPrice", p.DeliveryPrice),
+		})
 	}
-	if len(rpo.Description) > 35 {
-		msg = "Description may be between 1-36 characters"
+
+	return list
+}
+
+// currency reads an ISO 4217 currency code, codes are upper cased and may appear once
+func currency(v *utils.Validator, field string, code string, seen map[string]bool) string {
+	code = strings.ToUpper(code)
+	if !v.Required(field, code) {
+		return code
 	}
 
-	if len(msg) > 0 {
-		return errors.New(msg)
+	switch {
+	case !model.IsCurrency(code):
+		v.Add(field, utils.RuleCurrency, field+" "+code+" is not an ISO 4217 currency code")
+	case seen[code]:
+		v.Add(field, utils.RuleUnique, field+" "+code+" is priced more than once")
 	}
+	seen[code] = true
 
-	return nil
+	return code
 }
 
-// validatePrice check for the data validity of the provided prices
-// returns boolean
-func (h *Handler) validatePrices(price float64, key string) error {
-	priceStr := strconv.FormatFloat(price, 'f', -1, 64)
-	if len(priceStr) > 0 {
-		priceMatch := regexp.MustCompile(`^[0-9]+([.][0-9]{1,2})?$`)
-		if !priceMatch.MatchString(priceStr) {
-			return errors.New(key + " is not a valid decimal number")
+// adjustment reads a price adjustment of an option payload, field being Price or DeliveryPrice
+// Deltas may be negative, overrides may not
+func adjustment(v *utils.Validator, field string, mode string, n json.Number) (string, model.Money) {
+	var amount model.Money
+	if n != "" {
+		var err error
+		amount, err = model.ParseMoney(n.String())
+		switch {
+		case err == model.ErrMoneyRange:
+			v.Add(field+"Adjustment", utils.RuleRange, field+"Adjustment "+err.Error())
+		case err != nil:
+			v.Add(field+"Adjustment", utils.RuleDecimal, field+"Adjustment "+err.Error())
 		}
 	}
-	return nil
+
+	return checkAdjustment(v, field, mode, amount), amount
+}
+
+// checkAdjustment validates the mode of a price adjustment against its amount, returning the lower cased mode
+func checkAdjustment(v *utils.Validator, field string, mode string, amount model.Money) string {
+	mode = strings.ToLower(mode)
+	switch mode {
+	case "":
+		v.Check(amount == 0, field+"Mode", utils.RuleRequired, field+"Mode is required with a "+field+"Adjustment")
+	case model.AdjustDelta:
+	case model.AdjustOverride:
+		v.Check(amount >= 0, field+"Adjustment", utils.RuleRange, field+"Adjustment may not be negative when overriding")
+	default:
+		v.Add(field+"Mode", utils.RuleChoice, field+"Mode must be delta or override")
+	}
+
+	return mode
 }
+
+// ValidateGroupPayload check for the data validity of the json payload values
+// returns error, listing every violation found
+func (h *Handler) ValidateGroupPayload(c echo.Context, group *model.OptionGroup) error {
+	var rp GroupRequestPayload
+
+	// Check for binding error
+	if err := c.Bind(&rp); err != nil {
+		return err
+	}
+
+	v := utils.NewValidator()
+	if v.Required("Name", rp.Name) {
+		v.Length("Name", rp.Name, 1, 17)
+	}
+	v.Check(len(rp.Values) > 0, "Values", utils.RuleRequired, "Values is required")
+
+	// Every value becomes an option named after it
+	seen := make(map[string]bool, len(rp.Values))
+	for i, value := range rp.Values {
+		field := fmt.Sprintf("Values[%d]", i)
+		v.Length(field, value, 1, 17)
+		v.Check(!seen[strings.ToLower(value)], field, utils.RuleUnique, field+" "+value+" is given more than once")
+		seen[strings.ToLower(value)] = true
+		group.Options = append(group.Options, model.ProductOption{Name: value})
+	}
+	group.Name = rp.Name
+
+	return v.Err()
+}
+
+// ValidateVariantPayload check for the data validity of the json payload values
+// returns error, listing every violation found
+func (h *Handler) ValidateVariantPayload(c echo.Context, variant *model.ProductVariant) error {
+	var rp VariantRequestPayload
+
+	// Check for binding error
+	if err := c.Bind(&rp); err != nil {
+		return err
+	}
+
+	v := utils.NewValidator()
+	if v.Required("Sku", rp.Sku) {
+		v.Length("Sku", rp.Sku, 1, 64)
+		v.Check(skuMatch.MatchString(rp.Sku), "Sku", utils.RuleFormat, "Sku may only hold letters, digits, dashes and underscores")
+	}
+	variant.Sku = rp.Sku
+	variant.Price = price(v, "Price", rp.Price)
+	v.Check(rp.Enabled != nil, "Enabled", utils.RuleRequired, "Enabled is required")
+	if rp.Enabled != nil {
+		variant.Enabled = *rp.Enabled
+	}
+
+	return v.Err()
+}
+
+// ValidateStockPayload check for the data validity of the stock level json payload values
+func (h *Handler) ValidateStockPayload(c echo.Context, stock *model.Stock) error {
+	var rp StockRequestPayload
+
+	// Check for binding error
+	if err := c.Bind(&rp); err != nil {
+		return err
+	}
+
+	v := utils.NewValidator()
+	stock.OnHand = units(v, "OnHand", rp.OnHand, 0)
+	stock.LowStockThreshold = units(v, "LowStockThreshold", rp.LowStockThreshold, 0)
+
+	return v.Err()
+}
+
+// ValidateReservationPayload check for the data validity of the reservation json payload values
+func (h *Handler) ValidateReservationPayload(c echo.Context, reservation *model.StockReservation) error {
+	var rp ReservationRequestPayload
+
+	// Check for binding error
+	if err := c.Bind(&rp); err != nil {
+		return err
+	}
+
+	v := utils.NewValidator()
+	if rp.OptionId != "" {
+		v.UUID("OptionId", rp.OptionId)
+	}
+	reservation.OptionID = strings.ToUpper(rp.OptionId)
+	reservation.Quantity = units(v, "Quantity", rp.Quantity, 1)
+
+	return v.Err()
+}
+
+// units checks a required count of stock units lies between min and the maximum
+func units(v *utils.Validator, field string, n *int, min int) int {
+	if n == nil {
+		v.Add(field, utils.RuleRequired, field+" is required")
+		return 0
+	}
+	v.Check(*n >= min && *n <= model.MaxStock, field, utils.RuleRange,
+		fmt.Sprintf("%s must be between %d and %d", field, min, model.MaxStock))
+
+	return *n
+}
+
+// skuMatch accepts the characters allowed in a SKU
+var skuMatch = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
@@ -7,22 +7,47 @@ import (
 // Register : Merely a route registry to define and map routes against specific handler for processing
 func (h *Handler) Register(v1 *echo.Group) {
 
-	// `GET /products` - gets all products.
+	// `GET /products` - gets all published products, `status` lists the other states.
 	// `GET /products?name={name}` - finds all products matching the specified name.
+	// Listings are paged with `limit`, `offset` or `cursor` and ordered with `sort`.
 	v1.GET("", h.Get)
 
+	// `GET /products/trash` - lists the deleted products, most recently deleted first.
+	v1.GET("/trash", h.GetTrash)
+
+	// `POST /products/trash/{id}/restore` - brings a deleted product back with the options deleted along with it.
+	v1.POST("/trash/:id/restore", h.RestoreFromTrash)
+
+	// `DELETE /products/trash/{id}` - removes a deleted product for good.
+	v1.DELETE("/trash/:id", h.PurgeFromTrash)
+
 	// `GET /products/{id}` - gets the product that matches the specified ID - ID is a GUID.
 	v1.GET("/:id", h.GetByID)
 
 	// `POST /products` - creates a new product.
 	v1.POST("", h.Add)
 
-	// `PUT /products/{id}` - updates a product.
+	// `PUT /products/{id}` - replaces the editable fields and prices of a product.
 	v1.PUT("/:id", h.Update)
 
-	// `DELETE /products/{id}` - deletes a product and its options.
+	// `PATCH /products/{id}` - patches a product with a JSON merge patch or JSON patch.
+	v1.PATCH("/:id", h.Patch)
+
+	// `DELETE /products/{id}` - moves a product and its options to the trash.
 	v1.DELETE("/:id", h.Delete)
 
+	// `POST /products/{id}/publish` - publishes a draft product.
+	v1.POST("/:id/publish", h.Publish)
+
+	// `POST /products/{id}/archive` - archives a published product.
+	v1.POST("/:id/archive", h.Archive)
+
+	// `POST /products/{id}/restore` - brings an archived product back as a draft.
+	v1.POST("/:id/restore", h.Restore)
+
+	// `GET /products/{id}/price?options={optionId},{optionId}` - works out the price of a product with the chosen options.
+	v1.GET("/:id/price", h.GetPrice)
+
 	// `GET /products/{id}/options` - finds all options for a specified product.
 	v1.GET("/:id/options", h.GetOptions)
 
@@ -32,9 +57,63 @@ func (h *Handler) Register(v1 *echo.Group) {
 	// `POST /products/{id}/options` - adds a new product option to the specified product.
 	v1.POST("/:id/options", h.AddAnOption)
 
-	// `PUT /products/{id}/options/{optionId}` - updates the specified product option.
+	// `PUT /products/{id}/options/{optionId}` - replaces the editable fields of the specified product option.
 	v1.PUT("/:id/options/:optionId", h.UpdateAnOption)
 
-	//`DELETE /products/{id}/options/{optionId}` - deletes the specified product option.
+	// `PATCH /products/{id}/options/{optionId}` - patches the specified product option with a JSON merge patch or JSON patch.
+	v1.PATCH("/:id/options/:optionId", h.PatchAnOption)
+
+	//`DELETE /products/{id}/options/{optionId}` - moves the specified product option to the trash.
 	v1.DELETE("/:id/options/:optionId", h.DeleteAnOption)
+
+	// `GET /products/{id}/options/trash` - lists the deleted options of a product.
+	v1.GET("/:id/options/trash", h.GetOptionTrash)
+
+	// `POST /products/{id}/options/trash/{optionId}/restore` - brings a deleted option back.
+	v1.POST("/:id/options/trash/:optionId/restore", h.RestoreAnOption)
+
+	// `GET /products/{id}/groups` - lists the option groups of a product with their options.
+	v1.GET("/:id/groups", h.GetGroups)
+
+	// `POST /products/{id}/groups` - adds an option group, creating an option for each of its values.
+	v1.POST("/:id/groups", h.AddGroup)
+
+	// `GET /products/{id}/variants` - lists the variants of a product.
+	v1.GET("/:id/variants", h.GetVariants)
+
+	// `POST /products/{id}/variants/generate` - adds a variant for every new combination of options.
+	v1.POST("/:id/variants/generate", h.GenerateVariants)
+
+	// `GET /products/{id}/variants/{variantId}` - finds the specified variant.
+	v1.GET("/:id/variants/:variantId", h.GetAVariant)
+
+	// `PUT /products/{id}/variants/{variantId}` - replaces the SKU, price and enabled flag of a variant.
+	v1.PUT("/:id/variants/:variantId", h.UpdateAVariant)
+
+	// `DELETE /products/{id}/variants/{variantId}` - deletes the specified variant.
+	v1.DELETE("/:id/variants/:variantId", h.DeleteAVariant)
+
+	// `GET /products/{id}/stock` - lists the stock levels of a product and its options.
+	v1.GET("/:id/stock", h.GetStock)
+
+	// `PUT /products/{id}/stock` - sets the units on hand and low stock threshold of a product.
+	v1.PUT("/:id/stock", h.SetStock)
+
+	// `PUT /products/{id}/options/{optionId}/stock` - sets the units on hand and low stock threshold of an option.
+	v1.PUT("/:id/options/:optionId/stock", h.SetOptionStock)
+
+	// `POST /products/{id}/stock/reservations` - holds units for a pending order.
+	v1.POST("/:id/stock/reservations", h.AddReservation)
+
+	// `GET /products/{id}/stock/reservations/{reservationId}` - finds the specified reservation.
+	v1.GET("/:id/stock/reservations/:reservationId", h.GetAReservation)
+
+	// `POST /products/{id}/stock/reservations/{reservationId}/release` - makes the reserved units available again.
+	v1.POST("/:id/stock/reservations/:reservationId/release", h.ReleaseAReservation)
+
+	// `POST /products/{id}/stock/reservations/{reservationId}/commit` - takes the reserved units off hand.
+	v1.POST("/:id/stock/reservations/:reservationId/commit", h.CommitAReservation)
+
+	// `GET /products/{id}/stock/movements` - lists the stock ledger of a product, oldest first.
+	v1.GET("/:id/stock/movements", h.GetMovements)
 }
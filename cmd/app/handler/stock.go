@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"../model"
+	"../utils"
+	"github.com/labstack/echo"
+	"net/http"
+)
+
+// Stock specific handler specification
+// All handlers for the stock levels, reservations and ledger of a product are
+// defined and managed in here
+
+// Get stock retrieves the stock levels of a product and its options
+// return error
+// Router /products/{id}/stock [get]
+func (h *Handler) GetStock(c echo.Context) error {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to collect the levels
+	levels, err := h.front(c).ListStock(productId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not found or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with results
+	return c.JSONPretty(http.StatusOK, &levels, " ")
+}
+
+// Set stock sets the units on hand and the low stock threshold of a product
+// return error
+// Router /products/{id}/stock [put]
+func (h *Handler) SetStock(c echo.Context) error {
+	return h.setStock(c, "")
+}
+
+// Set option stock sets the units on hand and the low stock threshold of a product option
+// return error
+// Router /products/{id}/options/{optionId}/stock [put]
+func (h *Handler) SetOptionStock(c echo.Context) error {
+
+	// Grab incoming option id
+	optionId := c.Param("optionId")
+
+	// Validate ID
+	if !utils.IsValidUUID(optionId) {
+		return utils.InvalidID()
+	}
+
+	return h.setStock(c, optionId)
+}
+
+// setStock stores the stock level of the product or the given option
+func (h *Handler) setStock(c echo.Context, optionId string) (err error) {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Bind and validate the payload, bail out with every violation found
+	stock := model.Stock{ProductID: productId, OptionID: optionId}
+	if err = h.ValidateStockPayload(c, &stock); err != nil {
+		return err
+	}
+
+	// Run controller function to store the level
+	err = h.front(c).SetStock(&stock)
+
+	// Check for controller processing errors
+	if err != nil {
+
+		// Not found, units still reserved or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with the level
+	return c.JSONPretty(http.StatusOK, &stock, " ")
+}
+
+// Add a reservation holds units of a product or option for a pending order
+// return error
+// Router /products/{id}/stock/reservations [post]
+func (h *Handler) AddReservation(c echo.Context) (err error) {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Bind and validate the payload, bail out with every violation found
+	reservation := model.StockReservation{ProductID: productId}
+	if err = h.ValidateReservationPayload(c, &reservation); err != nil {
+		return err
+	}
+
+	// Run controller function to reserve the units
+	err = h.front(c).Reserve(&reservation)
+
+	// Check for controller processing errors
+	if err != nil {
+
+		// Not found, not enough stock or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with the reservation
+	return c.JSONPretty(http.StatusCreated, &reservation, " ")
+}
+
+// Get a specific reservation retrieves a particular reservation of a product
+// return error
+// Router /products/{id}/stock/reservations/{reservationId} [get]
+func (h *Handler) GetAReservation(c echo.Context) error {
+
+	// Grab IDs
+	productId := c.Param("id")
+	reservationId := c.Param("reservationId")
+
+	// Validate IDs
+	if !utils.IsValidUUID(productId) || !utils.IsValidUUID(reservationId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to pull the reservation
+	reservation, err := h.front(c).GetReservation(productId, reservationId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Notify about error
+		return err
+	}
+
+	// If the model didn't get populated
+	if reservation == nil {
+
+		// No reservation found with specification 404
+		return utils.NotFound()
+	}
+
+	// All good response with results
+	return c.JSONPretty(http.StatusOK, reservation, " ")
+}
+
+// Release a reservation makes the units of an open reservation available again
+// return error
+// Router /products/{id}/stock/reservations/{reservationId}/release [post]
+func (h *Handler) ReleaseAReservation(c echo.Context) error {
+	return h.closeReservation(c, h.front(c).ReleaseReservation)
+}
+
+// Commit a reservation takes the units of an open reservation off hand
+// return error
+// Router /products/{id}/stock/reservations/{reservationId}/commit [post]
+func (h *Handler) CommitAReservation(c echo.Context) error {
+	return h.closeReservation(c, h.front(c).CommitReservation)
+}
+
+// closeReservation moves an open reservation to its final status through close
+func (h *Handler) closeReservation(c echo.Context, close func(id string, reservationId string) (*model.StockReservation, error)) error {
+
+	// Grab IDs
+	productId := c.Param("id")
+	reservationId := c.Param("reservationId")
+
+	// Validate IDs
+	if !utils.IsValidUUID(productId) || !utils.IsValidUUID(reservationId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller function to close the reservation
+	reservation, err := close(productId, reservationId)
+
+	// Check for controller processing errors
+	if err != nil {
+
+		// Not found, already closed or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with the reservation
+	return c.JSONPretty(http.StatusOK, reservation, " ")
+}
+
+// Get stock movements retrieves one page of the stock ledger of a product, oldest first
+// return error
+// Router /products/{id}/stock/movements [get]
+func (h *Handler) GetMovements(c echo.Context) error {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Read paging, the ledger has a fixed order
+	_, page, err := h.parsePaging(c, map[string]string{})
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
+	}
+
+	// Run controller to collect the movements
+	movements, err := h.front(c).ListMovements(productId, page)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not found or internal, the error handler decides
+		return err
+	}
+
+	// Link the neighbouring pages
+	movements.Meta.Links = h.pageLinks(c, movements.Meta)
+
+	// All good respond with results
+	return c.JSONPretty(http.StatusOK, &movements, " ")
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"../utils"
+	"github.com/labstack/echo"
+	"net/http"
+)
+
+// Trash specific handler specification
+// All handlers for the deleted products and options are defined and
+// managed in here
+
+// Get trash retrieves one page of the deleted products, most recently deleted first
+// return error
+// Router /products/trash?limit={}&offset={} [get]
+func (h *Handler) GetTrash(c echo.Context) error {
+
+	// Read paging, the trash has a fixed order
+	_, page, err := h.parsePaging(c, map[string]string{})
+	if err != nil {
+		return utils.InvalidRequest(err.Error())
+	}
+
+	// Run controller to collect the deleted products
+	productList, err := h.front(c).ListTrash(page)
+
+	// Check for processing error
+	if err != nil {
+
+		// Return issues
+		return err
+	}
+
+	// Link the neighbouring pages
+	productList.Meta.Links = h.pageLinks(c, productList.Meta)
+
+	// All good respond with results
+	return c.JSONPretty(http.StatusOK, &productList, " ")
+}
+
+// Restore from trash brings a deleted product back along with the options deleted with it
+// return error
+// Router /products/trash/{id}/restore [post]
+func (h *Handler) RestoreFromTrash(c echo.Context) error {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to restore the product
+	product, err := h.front(c).RestoreProduct(productId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not in the trash or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with the restored product
+	setETag(c, product.Version)
+	return c.JSONPretty(http.StatusOK, product, " ")
+}
+
+// Purge from trash removes a deleted product for good
+// return error
+// Router /products/trash/{id} [delete]
+func (h *Handler) PurgeFromTrash(c echo.Context) error {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to purge the product
+	err := h.front(c).PurgeProduct(productId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not in the trash or internal, the error handler decides
+		return err
+	}
+
+	// All good response
+	return c.JSONPretty(http.StatusOK, map[string]interface{}{"result": "ok"}, " ")
+}
+
+// Get option trash retrieves the deleted options of a product, most recently deleted first
+// return error
+// Router /products/{id}/options/trash [get]
+func (h *Handler) GetOptionTrash(c echo.Context) error {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to collect the deleted options
+	options, err := h.front(c).ListDeletedOptions(productId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not found or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with results
+	return c.JSONPretty(http.StatusOK, &options, " ")
+}
+
+// Restore an option brings a deleted option of a product back
+// return error
+// Router /products/{id}/options/trash/{optionId}/restore [post]
+func (h *Handler) RestoreAnOption(c echo.Context) error {
+
+	// Grab IDs
+	productId := c.Param("id")
+	optionId := c.Param("optionId")
+
+	// Validate IDs
+	if !utils.IsValidUUID(productId) || !utils.IsValidUUID(optionId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to restore the option
+	option, err := h.front(c).RestoreOption(productId, optionId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not in the trash or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with the restored option
+	setETag(c, option.Version)
+	return c.JSONPretty(http.StatusOK, option, " ")
+}
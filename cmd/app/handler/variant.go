@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"../model"
+	"../utils"
+	"github.com/labstack/echo"
+	"net/http"
+)
+
+// Option group and variant specific handler specification
+// All handlers for the groups and variants of a product are defined and
+// managed in here
+
+// Get option groups retrieves the option groups of a product with their options
+// return error
+// Router /products/{id}/groups [get]
+func (h *Handler) GetGroups(c echo.Context) error {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to collect the groups
+	groups, err := h.front(c).Groups(productId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not found or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with results
+	return c.JSONPretty(http.StatusOK, map[string]interface{}{"Items": groups}, " ")
+}
+
+// Add an option group creates an option for every value of a new group
+// return error
+// Router /products/{id}/groups [post]
+func (h *Handler) AddGroup(c echo.Context) (err error) {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Bind and validate the payload, bail out with every violation found
+	group := model.OptionGroup{}
+	if err = h.ValidateGroupPayload(c, &group); err != nil {
+		return err
+	}
+
+	// Run controller to create the options of the group
+	err = h.front(c).CreateGroup(productId, &group)
+
+	// Check for creation error
+	if err != nil {
+
+		// Hand over to the error handler
+		return err
+	}
+
+	// All good response
+	return c.JSONPretty(http.StatusCreated, map[string]interface{}{"result": "ok"}, " ")
+}
+
+// Get product variants retrieves the variants of a product
+// return error
+// Router /products/{id}/variants [get]
+func (h *Handler) GetVariants(c echo.Context) error {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to list the variants
+	variants, err := h.front(c).ListVariants(productId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not found or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with results
+	return c.JSONPretty(http.StatusOK, &variants, " ")
+}
+
+// Generate product variants adds a variant for every combination of options which has none yet
+// return error
+// Router /products/{id}/variants/generate [post]
+func (h *Handler) GenerateVariants(c echo.Context) error {
+
+	// Grab incoming product id
+	productId := c.Param("id")
+
+	// Validate ID
+	if !utils.IsValidUUID(productId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to generate the missing variants
+	variants, err := h.front(c).GenerateVariants(productId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Not found, too many combinations or internal, the error handler decides
+		return err
+	}
+
+	// All good respond with every variant of the product
+	return c.JSONPretty(http.StatusOK, &variants, " ")
+}
+
+// Get a specific variant retrieves a particular variant of a product
+// return error
+// Router /products/{id}/variants/{variantId} [get]
+func (h *Handler) GetAVariant(c echo.Context) error {
+
+	// Grab IDs
+	productId := c.Param("id")
+	variantId := c.Param("variantId")
+
+	// Validate IDs
+	if !utils.IsValidUUID(productId) || !utils.IsValidUUID(variantId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller to pull the variant
+	variant, err := h.front(c).GetVariant(productId, variantId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Notify about error
+		return err
+	}
+
+	// If the model didn't get populated
+	if variant == nil {
+
+		// No variant found with specification 404
+		return utils.NotFound()
+	}
+
+	// All good response with results
+	return c.JSONPretty(http.StatusOK, variant, " ")
+}
+
+// Update a variant replaces the SKU, price and enabled flag of a variant
+// return error
+// Router /products/{id}/variants/{variantId} [put]
+func (h *Handler) UpdateAVariant(c echo.Context) (err error) {
+
+	// Grab IDs
+	productId := c.Param("id")
+	variantId := c.Param("variantId")
+
+	// Validate IDs
+	if !utils.IsValidUUID(productId) || !utils.IsValidUUID(variantId) {
+		return utils.InvalidID()
+	}
+
+	// Bind and validate the payload, bail out with every violation found
+	variant := model.ProductVariant{}
+	if err = h.ValidateVariantPayload(c, &variant); err != nil {
+		return err
+	}
+
+	// Run controller function to update
+	err = h.front(c).UpdateVariant(productId, variantId, &variant)
+
+	// Check for controller processing errors
+	if err != nil {
+
+		// Not found, taken SKU or internal, the error handler decides
+		return err
+	}
+
+	// All good response
+	return c.JSONPretty(http.StatusOK, map[string]interface{}{"result": "ok"}, " ")
+}
+
+// Delete a variant removes a specific variant of a product
+// return error
+// Router /products/{id}/variants/{variantId} [delete]
+func (h *Handler) DeleteAVariant(c echo.Context) (err error) {
+
+	// Grab IDs
+	productId := c.Param("id")
+	variantId := c.Param("variantId")
+
+	// Validate IDs
+	if !utils.IsValidUUID(productId) || !utils.IsValidUUID(variantId) {
+		return utils.InvalidID()
+	}
+
+	// Run controller function to delete
+	err = h.front(c).DeleteVariant(productId, variantId)
+
+	// Check for processing error
+	if err != nil {
+
+		// Return issues
+		return err
+	}
+
+	// All good response
+	return c.JSONPretty(http.StatusOK, map[string]interface{}{"result": "ok"}, " ")
+}
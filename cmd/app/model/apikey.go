@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// APIKey lets a service-to-service client authenticate without a JWT
+// Only the hash of its secret is kept, the key itself is shown once when it is created
+// Scopes are space separated, like the scope claim of a token, and the role and team
+// say what the client may change, like the claims of a token
+type APIKey struct {
+	ID         string     `gorm:"column:Id;type:varchar;primary_key" json:"Id"`
+	Name       string     `gorm:"column:Name;type:varchar" json:"Name"`
+	Hash       string     `gorm:"column:Hash;type:varchar" json:"-"`
+	Scopes     string     `gorm:"column:Scopes;type:varchar" json:"Scopes"`
+	Role       string     `gorm:"column:Role;type:varchar" json:"Role"`
+	Team       string     `gorm:"column:Team;type:varchar" json:"Team,omitempty"`
+	Disabled   bool       `gorm:"column:Disabled" json:"Disabled"`
+	CreatedAt  time.Time  `gorm:"column:CreatedAt" json:"CreatedAt"`
+	LastUsedAt *time.Time `gorm:"column:LastUsedAt" json:"LastUsedAt,omitempty"`
+}
+
+// TableName maps the model onto the ApiKeys table
+func (APIKey) TableName() string {
+	return "ApiKeys"
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// Currency models
+// Price and DeliveryPrice of a product are in the default currency of the
+// service, explicit prices in other currencies are kept alongside, and a rate
+// table converts out of the default currency when no explicit price exists
+// Amounts in every currency have the decimal places of its ISO 4217 minor units
+
+// ProductPrice is the price of a product in one currency
+type ProductPrice struct {
+	ProductID     string `gorm:"column:ProductId;type:varchar;primary_key" json:"-"`
+	Currency      string `gorm:"column:Currency;type:varchar;primary_key" json:"Currency"`
+	Price         Money  `gorm:"column:Price;type:decimal(12,3)" json:"Price"`
+	DeliveryPrice Money  `gorm:"column:DeliveryPrice;type:decimal(12,3)" json:"DeliveryPrice"`
+}
+
+// TableName maps the model onto the ProductPrices table
+func (ProductPrice) TableName() string {
+	return "ProductPrices"
+}
+
+// Pricing holds the default currency and the conversion rates out of it
+// A rate is the amount of a currency worth one unit of the default currency
+type Pricing struct {
+	Currency string
+	Rates    map[string]float64
+}
+
+// ErrNoRate is returned when converting into a currency the rate table does not know
+var ErrNoRate = errors.New("has no conversion rate")
+
+// Convert turns an amount in the default currency into the given currency, rounded to its minor unit
+// It fails with ErrNoRate when no rate is known and ErrMoneyRange when the result cannot be stored
+func (p Pricing) Convert(m Money, currency string) (Money, error) {
+	if currency == p.Currency {
+		return m, nil
+	}
+
+	rate, ok := p.Rates[currency]
+	if !ok {
+		return 0, ErrNoRate
+	}
+
+	converted := m.Float() * rate
+	if math.Abs(converted) > MaxMoney.Float() {
+		return 0, ErrMoneyRange
+	}
+	rounded := MoneyFromFloat(converted).Round(MinorUnits(currency))
+	if !rounded.InRange() {
+		return 0, ErrMoneyRange
+	}
+
+	return rounded, nil
+}
+
+// MinorUnits returns the number of decimal places of the currency, as set by ISO 4217
+func MinorUnits(code string) int {
+	switch {
+	case strings.Contains(" "+noMinorUnits+" ", " "+code+" "):
+		return 0
+	case strings.Contains(" "+threeMinorUnits+" ", " "+code+" "):
+		return 3
+	}
+
+	return 2
+}
+
+// IsCurrency reports whether the code is an active ISO 4217 currency code
+func IsCurrency(code string) bool {
+	return len(code) == 3 && strings.Contains(" "+currencies+" ", " "+code+" ")
+}
+
+// noMinorUnits lists the currencies without decimal places
+const noMinorUnits = "BIF CLP DJF GNF ISK JPY KMF KRW PYG RWF UGX VND VUV XAF XOF XPF"
+
+// threeMinorUnits lists the currencies with three decimal places, every other one has two
+const threeMinorUnits = "BHD IQD JOD KWD LYD OMR TND"
+
+// currencies lists the active ISO 4217 currency codes
+const currencies = "AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BRL BSD BTN " +
+	"BWP BYN BZD CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS " +
+	"GIP GMD GNF GTQ GYD HKD HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD " +
+	"KZT LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR " +
+	"NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN " +
+	"SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX USD UYU UZS VES VND VUV WST XAF XCD XOF XPF YER " +
+	"ZAR ZMW ZWL"
@@ -0,0 +1,94 @@
+package model
+
+// Filter models
+// A filter is a list of conditions which all have to hold, written in query
+// parameters as field[op]=value, e.g. price[gte]=10&price[lt]=50, with a few
+// named shortcuts like minPrice=10
+// The same language is used for every listing, only the fields differ
+
+// Kinds of filterable fields
+const (
+	FilterNumber = "number"
+	FilterString = "string"
+	FilterBool   = "bool"
+)
+
+// Filter operators
+const (
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpGt       = "gt"
+	OpGte      = "gte"
+	OpLt       = "lt"
+	OpLte      = "lte"
+	OpPrefix   = "prefix"
+	OpContains = "contains"
+)
+
+// FilterOps lists the operators each kind of field supports
+var FilterOps = map[string][]string{
+	FilterNumber: {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte},
+	FilterString: {OpEq, OpNe, OpPrefix, OpContains},
+	FilterBool:   {OpEq},
+}
+
+// FilterField describes a filterable field
+type FilterField struct {
+	Field string
+	Kind  string
+}
+
+// FilterAlias is a named shortcut for a condition on a field
+type FilterAlias struct {
+	Field string
+	Op    string
+}
+
+// Condition compares one field against a value
+// Values are float64 for numbers, string for strings and bool for booleans
+type Condition struct {
+	Field string
+	Op    string
+	Value interface{}
+}
+
+// Filter holds the conditions which all have to hold
+type Filter []Condition
+
+// Pseudo field telling whether a product has any options
+const FieldHasOptions = "HasOptions"
+
+// Pseudo fields telling whether any stock of a product, or of one of its options,
+// is available and whether any has run low
+const (
+	FieldInStock  = "InStock"
+	FieldLowStock = "LowStock"
+)
+
+// Filterable product fields keyed by their lower cased query name
+var ProductFilterFields = map[string]FilterField{
+	"name":          {Field: "Name", Kind: FilterString},
+	"description":   {Field: "Description", Kind: FilterString},
+	"price":         {Field: "Price", Kind: FilterNumber},
+	"deliveryprice": {Field: "DeliveryPrice", Kind: FilterNumber},
+	"hasoptions":    {Field: FieldHasOptions, Kind: FilterBool},
+	"instock":       {Field: FieldInStock, Kind: FilterBool},
+	"lowstock":      {Field: FieldLowStock, Kind: FilterBool},
+}
+
+// Shortcuts for the common product conditions keyed by their lower cased query name
+var ProductFilterAliases = map[string]FilterAlias{
+	"minprice":         {Field: "price", Op: OpGte},
+	"maxprice":         {Field: "price", Op: OpLte},
+	"mindeliveryprice": {Field: "deliveryprice", Op: OpGte},
+	"maxdeliveryprice": {Field: "deliveryprice", Op: OpLte},
+	"hasoptions":       {Field: "hasoptions", Op: OpEq},
+	"instock":          {Field: "instock", Op: OpEq},
+	"lowstock":         {Field: "lowstock", Op: OpEq},
+}
+
+// Filterable product option fields keyed by their lower cased query name
+var OptionFilterFields = map[string]FilterField{
+	"name":        {Field: "Name", Kind: FilterString},
+	"description": {Field: "Description", Kind: FilterString},
+}
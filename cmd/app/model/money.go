@@ -0,0 +1,205 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money model
+// Amounts are kept as a whole number of thousandths so sums and comparisons are exact,
+// which covers the minor units of every ISO 4217 currency, from none for JPY to three for KWD
+// Input is never rounded, an amount with more decimal places than its currency has is rejected,
+// while computed amounts are rounded half away from zero to the minor unit of their currency
+// The range matches the decimal(12,3) columns the amounts are stored in
+
+// Money is an exact amount in thousandths of the major unit of its currency
+type Money int64
+
+// Scale and bounds of an amount
+const (
+	MoneyScale       = 3
+	MaxMoney   Money = 999999999999
+	MinMoney   Money = -MaxMoney
+)
+
+// Errors returned when reading an amount
+var (
+	ErrMoneyFormat = errors.New("is not a valid decimal number")
+	ErrMoneyScale  = fmt.Errorf("may have at most %d decimal places", MoneyScale)
+	ErrMoneyRange  = fmt.Errorf("must be between %s and %s", MinMoney, MaxMoney)
+)
+
+// ParseMoney reads a plain decimal amount like 12, 12.5 or -0.99
+// Exponents, thousands separators and more than three decimal places are rejected,
+// the decimal places a currency allows are checked with Fits
+func ParseMoney(s string) (Money, error) {
+	digits := s
+	negative := strings.HasPrefix(digits, "-")
+	if negative {
+		digits = digits[1:]
+	}
+
+	whole, fraction := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		whole, fraction = digits[:i], digits[i+1:]
+		if fraction == "" {
+			return 0, ErrMoneyFormat
+		}
+	}
+	if whole == "" || !isDigits(whole) || !isDigits(fraction) {
+		return 0, ErrMoneyFormat
+	}
+
+	// Trailing zeros do not add precision
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > MoneyScale {
+		return 0, ErrMoneyScale
+	}
+
+	whole = strings.TrimLeft(whole, "0")
+	if len(whole) > 9 {
+		return 0, ErrMoneyRange
+	}
+
+	units, _ := strconv.ParseInt(whole+fraction+strings.Repeat("0", MoneyScale-len(fraction)), 10, 64)
+	if negative {
+		units = -units
+	}
+
+	m := Money(units)
+	if m > MaxMoney || m < MinMoney {
+		return 0, ErrMoneyRange
+	}
+
+	return m, nil
+}
+
+// MoneyFromFloat rounds a computed amount to the nearest thousandth
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * 1000))
+}
+
+// Fits reports whether the amount has no more decimal places than the minor units given
+func (m Money) Fits(minorUnits int) bool {
+	return int64(m)%minorUnit(minorUnits) == 0
+}
+
+// Round rounds the amount half away from zero to the minor units given
+func (m Money) Round(minorUnits int) Money {
+	unit := minorUnit(minorUnits)
+	v, half := int64(m), unit/2
+	if v < 0 {
+		return Money(-((-v + half) / unit * unit))
+	}
+
+	return Money((v + half) / unit * unit)
+}
+
+// InRange reports whether the amount can be stored
+func (m Money) InRange() bool {
+	return m >= MinMoney && m <= MaxMoney
+}
+
+// minorUnit returns the amount of one minor unit of a currency with the minor units given
+func minorUnit(minorUnits int) int64 {
+	unit := int64(1)
+	for i := minorUnits; i < MoneyScale; i++ {
+		unit *= 10
+	}
+
+	return unit
+}
+
+// isDigits reports whether s holds ASCII digits only
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String formats the amount with two decimal places, or three when it has a third one
+func (m Money) String() string {
+	sign := ""
+	units := int64(m)
+	if units < 0 {
+		sign, units = "-", -units
+	}
+
+	if units%10 == 0 {
+		return fmt.Sprintf("%s%d.%02d", sign, units/1000, units%1000/10)
+	}
+	return fmt.Sprintf("%s%d.%03d", sign, units/1000, units%1000)
+}
+
+// Float returns the amount as a float, only meant for ordering, filtering and conversion
+func (m Money) Float() float64 {
+	return float64(m) / 1000
+}
+
+// MarshalJSON writes the amount as a JSON number with two decimal places, or three when it has a third one
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads the amount from a JSON number or a quoted number
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	v, err := ParseMoney(s)
+	if err != nil {
+		return fmt.Errorf("amount %s %v", s, err)
+	}
+
+	*m = v
+	return nil
+}
+
+// Value stores the amount as an exact decimal string
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads an amount from a decimal, real, integer or NULL column
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v * 1000)
+	case float64:
+		*m = MoneyFromFloat(v)
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+
+	return nil
+}
+
+// scanString reads a decimal column, which databases may pad with extra zeros
+func (m *Money) scanString(s string) error {
+	v, err := ParseMoney(s)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money: %v", s, err)
+	}
+
+	*m = v
+	return nil
+}
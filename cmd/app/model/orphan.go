@@ -0,0 +1,7 @@
+package model
+
+// Orphans counts the rows of a table pointing at a product or option which no longer exists
+type Orphans struct {
+	Table string `json:"Table"`
+	Rows  int    `json:"Rows"`
+}
@@ -1,16 +1,79 @@
 package model
 
+import "time"
+
 // Product model is the basis for product
 type Product struct {
 	ID            string          `gorm:"column:Id;type:varchar;primary_key" json:"Id" query:"id"`
 	Name          string          `gorm:"column:Name;type:varchar" json:"Name" query:"Name"`
 	Description   string          `gorm:"column:Description;type:varchar" json:"Description" query:"Description"`
-	Price         float64         `gorm:"column:Price;type:decimal(6,2)" json:"Price" query:"Price"`
-	DeliveryPrice float64         `gorm:"column:DeliveryPrice;type:decimal(6,2)" json:"DeliveryPrice" query:"DeliveryPrice"`
+	Price         Money           `gorm:"column:Price;type:decimal(12,3)" json:"Price" query:"Price"`
+	DeliveryPrice Money           `gorm:"column:DeliveryPrice;type:decimal(12,3)" json:"DeliveryPrice" query:"DeliveryPrice"`
+	Status        string          `gorm:"column:Status;type:varchar" json:"Status"`
+	Team          string          `gorm:"column:Team;type:varchar" json:"Team,omitempty"`
+	Owner         string          `gorm:"column:Owner;type:varchar" json:"Owner,omitempty"`
+	DeletedAt     *time.Time      `gorm:"column:DeletedAt" json:"DeletedAt,omitempty"`
+	Version       int             `gorm:"column:Version" json:"Version"`
 	ProductOption []ProductOption `gorm:"foreignkey:ProductId; association_foreignkey:Id" json:"-"`
+
+	// Currency of Price and DeliveryPrice, set on reads
+	Currency string `gorm:"-" json:"Currency,omitempty"`
+
+	// Explicit prices in currencies other than the default one
+	Prices []ProductPrice `gorm:"-" json:"Prices,omitempty"`
+}
+
+// Products and options start at version 1 and every change bumps the version,
+// which is what the ETag of their representation is made of
+const FirstVersion = 1
+
+// Product statuses
+// New products start as drafts and only published ones are listed by default
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// ProductStatuses holds every status in lifecycle order
+var ProductStatuses = []string{StatusDraft, StatusPublished, StatusArchived}
+
+// Transition moves a product from one status to another
+type Transition struct {
+	From string
+	To   string
+}
+
+// Product transitions keyed by the action taking them
+// A restored product goes back to draft so it is reviewed before being published again
+var ProductTransitions = map[string]Transition{
+	"publish": {From: StatusDraft, To: StatusPublished},
+	"archive": {From: StatusPublished, To: StatusArchived},
+	"restore": {From: StatusArchived, To: StatusDraft},
+}
+
+// TableName maps the model onto the Products table
+func (Product) TableName() string {
+	return "Products"
+}
+
+// SortValue returns the value of the named sort field, the Id when no field is named
+// Amounts are returned as floats, which order them exactly within their range
+func (p Product) SortValue(field string) interface{} {
+	switch field {
+	case "Name":
+		return p.Name
+	case "Price":
+		return p.Price.Float()
+	case "DeliveryPrice":
+		return p.DeliveryPrice.Float()
+	}
+
+	return p.ID
 }
 
 // Product list holds an array of product models
 type ProductList struct {
 	Items []Product `json:"Items"`
+	Meta  *ListMeta `json:"Meta,omitempty"`
 }
@@ -1,14 +1,119 @@
 package model
 
+import "time"
+
 // Product option model is the basis for product options
 type ProductOption struct {
 	ID          string `gorm:"column:Id;type:varchar;primary_key" json:"Id" query:"id"`
 	ProductID   string `gorm:"column:ProductId;type:varchar" json:"ProductId" query:"ProductId"`
 	Name        string `gorm:"column:Name;type:varchar" json:"Name" query:"Name"`
 	Description string `gorm:"column:Description;type:varchar" json:"Description" query:"Description"`
+
+	// Attribute the option is a value of, like Size, empty for add-ons
+	Group string `gorm:"column:Group;type:varchar" json:"Group,omitempty"`
+
+	// Adjustments choosing the option makes to the price of the product, see Adjust
+	PriceMode               string `gorm:"column:PriceMode;type:varchar" json:"PriceMode,omitempty"`
+	PriceAdjustment         Money  `gorm:"column:PriceAdjustment;type:decimal(12,3)" json:"PriceAdjustment,omitempty"`
+	DeliveryPriceMode       string `gorm:"column:DeliveryPriceMode;type:varchar" json:"DeliveryPriceMode,omitempty"`
+	DeliveryPriceAdjustment Money  `gorm:"column:DeliveryPriceAdjustment;type:decimal(12,3)" json:"DeliveryPriceAdjustment,omitempty"`
+
+	// Set while the option sits in the trash
+	DeletedAt *time.Time `gorm:"column:DeletedAt" json:"DeletedAt,omitempty"`
+
+	// Bumped by every change, like the version of a product
+	Version int `gorm:"column:Version" json:"Version"`
+}
+
+// Price adjustment modes
+// A delta is added to the price and may be negative, an override replaces it
+const (
+	AdjustDelta    = "delta"
+	AdjustOverride = "override"
+)
+
+// TableName maps the model onto the ProductOptions table
+func (ProductOption) TableName() string {
+	return "ProductOptions"
+}
+
+// SortValue returns the value of the named sort field, the Id when no field is named
+func (o ProductOption) SortValue(field string) interface{} {
+	if field == "Name" {
+		return o.Name
+	}
+
+	return o.ID
 }
 
 // Product option list holds an array of product option models
 type ProductOptionList struct {
 	Items []ProductOption `json:"Items"`
+	Meta  *ListMeta       `json:"Meta,omitempty"`
+}
+
+// EffectivePrice is what a product costs with a chosen set of options
+type EffectivePrice struct {
+	ProductID         string   `json:"ProductId"`
+	OptionIDs         []string `json:"OptionIds"`
+	Currency          string   `json:"Currency"`
+	BasePrice         Money    `json:"BasePrice"`
+	BaseDeliveryPrice Money    `json:"BaseDeliveryPrice"`
+	Price             Money    `json:"Price"`
+	DeliveryPrice     Money    `json:"DeliveryPrice"`
+}
+
+// Adjustment is one option's change to an amount
+type Adjustment struct {
+	OptionID string
+	Mode     string
+	Amount   Money
+}
+
+// Adjust applies the adjustments of the chosen options to a base amount
+// At most one option may override the amount, the deltas of all options are added
+// on top of it, and the result never drops below zero
+// Returns the ID of a second overriding option when two of them clash
+func Adjust(base Money, adjustments []Adjustment) (Money, string) {
+	amount := base
+	overridden := ""
+	for _, a := range adjustments {
+		if a.Mode == AdjustOverride {
+			if overridden != "" {
+				return 0, a.OptionID
+			}
+			amount, overridden = a.Amount, a.OptionID
+		}
+	}
+
+	for _, a := range adjustments {
+		if a.Mode == AdjustDelta {
+			amount += a.Amount
+		}
+	}
+	if amount < 0 {
+		amount = 0
+	}
+
+	return amount, ""
+}
+
+// PriceAdjustments returns the price adjustments of the options
+func PriceAdjustments(options []ProductOption) []Adjustment {
+	var adjustments []Adjustment
+	for _, o := range options {
+		adjustments = append(adjustments, Adjustment{OptionID: o.ID, Mode: o.PriceMode, Amount: o.PriceAdjustment})
+	}
+
+	return adjustments
+}
+
+// DeliveryPriceAdjustments returns the delivery price adjustments of the options
+func DeliveryPriceAdjustments(options []ProductOption) []Adjustment {
+	var adjustments []Adjustment
+	for _, o := range options {
+		adjustments = append(adjustments, Adjustment{OptionID: o.ID, Mode: o.DeliveryPriceMode, Amount: o.DeliveryPriceAdjustment})
+	}
+
+	return adjustments
 }
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Listing query models
+// Describe which slice of a listing is wanted and how it is ordered so the
+// storage layer can push paging and sorting down into its queries
+
+// Bounds of the page size
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Sortable product fields keyed by their lower cased query name
+var ProductSortFields = map[string]string{
+	"name":          "Name",
+	"price":         "Price",
+	"deliveryprice": "DeliveryPrice",
+}
+
+// SortRelevance orders full-text search results by how well they match
+const SortRelevance = "Relevance"
+
+// Search modes
+// Exact matching is case sensitive, prefix and substring matching are not,
+// and full-text matching finds every word of the term in any order
+const (
+	SearchExact    = "exact"
+	SearchPrefix   = "prefix"
+	SearchContains = "contains"
+	SearchFullText = "fulltext"
+)
+
+// Searchable product fields keyed by their lower cased query name
+var ProductSearchFields = map[string]string{
+	"name":        "Name",
+	"description": "Description",
+}
+
+// Sortable product option fields keyed by their lower cased query name
+var OptionSortFields = map[string]string{
+	"name": "Name",
+}
+
+// Sort orders a listing by one field, ties are broken by Id
+// An empty field orders by Id alone
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Page selects a window of a listing, either by offset or by cursor
+type Page struct {
+	Limit  int
+	Offset int
+	Cursor *Cursor
+}
+
+// Cursor marks the last row seen so the next page starts right after it
+// Orderings without a stable key, like relevance, continue from an offset instead
+type Cursor struct {
+	Field  string      `json:"f"`
+	Desc   bool        `json:"d,omitempty"`
+	Value  interface{} `json:"v"`
+	ID     string      `json:"i,omitempty"`
+	Offset int         `json:"o,omitempty"`
+}
+
+// Search looks for a term in the given fields using one of the search modes
+type Search struct {
+	Term   string
+	Mode   string
+	Fields []string
+}
+
+// ProductQuery describes a product listing
+// Prices are read in the given currency, the default one when empty
+type ProductQuery struct {
+	Name     string
+	Search   *Search
+	Filter   Filter
+	Sort     Sort
+	Page     Page
+	Currency string
+
+	// Statuses the products may be in, any status when empty
+	Statuses []string
+}
+
+// OptionQuery describes a product option listing
+type OptionQuery struct {
+	Filter Filter
+	Sort   Sort
+	Page   Page
+}
+
+// ListMeta carries the paging details of a listing
+type ListMeta struct {
+	Total      int       `json:"Total"`
+	Limit      int       `json:"Limit"`
+	Offset     int       `json:"Offset"`
+	NextCursor string    `json:"NextCursor,omitempty"`
+	Links      PageLinks `json:"Links"`
+}
+
+// PageLinks holds ready to follow links to the neighbouring pages
+type PageLinks struct {
+	Self string `json:"Self"`
+	Next string `json:"Next,omitempty"`
+	Prev string `json:"Prev,omitempty"`
+}
+
+// Encode turns the cursor into an opaque token
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor reads a token produced by Cursor.Encode
+func DecodeCursor(token string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("cursor is not valid")
+	}
+
+	var c Cursor
+	if err = json.Unmarshal(raw, &c); err != nil || (c.ID == "" && c.Field != SortRelevance) {
+		return nil, errors.New("cursor is not valid")
+	}
+
+	return &c, nil
+}
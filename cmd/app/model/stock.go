@@ -0,0 +1,100 @@
+package model
+
+import "time"
+
+// Stock models
+// Stock is tracked per product, with OptionId empty, and per option where the
+// option is sold on its own terms
+// Reserved units are held for a pending order until the reservation is either
+// committed, taking the units off hand, or released, making them available again
+// Every change to a stock level is recorded as a movement in the ledger
+
+// MaxStock caps the units of a stock level, a reservation or a threshold
+const MaxStock = 1000000000
+
+// Stock is the stock level of a product or one of its options
+type Stock struct {
+	ProductID         string `gorm:"column:ProductId;type:varchar;primary_key" json:"ProductId"`
+	OptionID          string `gorm:"column:OptionId;type:varchar;primary_key" json:"OptionId,omitempty"`
+	OnHand            int    `gorm:"column:OnHand" json:"OnHand"`
+	Reserved          int    `gorm:"column:Reserved" json:"Reserved"`
+	LowStockThreshold int    `gorm:"column:LowStockThreshold" json:"LowStockThreshold"`
+
+	// Worked out from the levels above
+	Available int  `gorm:"-" json:"Available"`
+	Low       bool `gorm:"-" json:"Low"`
+}
+
+// TableName maps the model onto the Stock table
+func (Stock) TableName() string {
+	return "Stock"
+}
+
+// Compute works out the available units and whether they have run low
+func (s *Stock) Compute() {
+	s.Available = s.OnHand - s.Reserved
+	s.Low = s.Available <= s.LowStockThreshold
+}
+
+// Stock list holds the stock levels of a product
+type StockList struct {
+	Items []Stock `json:"Items"`
+}
+
+// Reservation statuses
+const (
+	ReservationOpen      = "open"
+	ReservationReleased  = "released"
+	ReservationCommitted = "committed"
+)
+
+// StockReservation holds units of a product or option for a pending order
+type StockReservation struct {
+	ID        string    `gorm:"column:Id;type:varchar;primary_key" json:"Id"`
+	ProductID string    `gorm:"column:ProductId;type:varchar" json:"ProductId"`
+	OptionID  string    `gorm:"column:OptionId;type:varchar" json:"OptionId,omitempty"`
+	Quantity  int       `gorm:"column:Quantity" json:"Quantity"`
+	Status    string    `gorm:"column:Status;type:varchar" json:"Status"`
+	CreatedAt time.Time `gorm:"column:CreatedAt" json:"CreatedAt"`
+	UpdatedAt time.Time `gorm:"column:UpdatedAt" json:"UpdatedAt"`
+}
+
+// TableName maps the model onto the StockReservations table
+func (StockReservation) TableName() string {
+	return "StockReservations"
+}
+
+// Movement kinds
+// An adjustment changes the units on hand, the others follow a reservation
+const (
+	MovementAdjust  = "adjust"
+	MovementReserve = "reserve"
+	MovementRelease = "release"
+	MovementCommit  = "commit"
+)
+
+// StockMovement is one entry of the stock ledger
+// Changes are signed, and the levels are the ones right after the movement
+type StockMovement struct {
+	ID             string    `gorm:"column:Id;type:varchar;primary_key" json:"Id"`
+	ProductID      string    `gorm:"column:ProductId;type:varchar" json:"ProductId"`
+	OptionID       string    `gorm:"column:OptionId;type:varchar" json:"OptionId,omitempty"`
+	Kind           string    `gorm:"column:Kind;type:varchar" json:"Kind"`
+	OnHandChange   int       `gorm:"column:OnHandChange" json:"OnHandChange"`
+	ReservedChange int       `gorm:"column:ReservedChange" json:"ReservedChange"`
+	OnHand         int       `gorm:"column:OnHand" json:"OnHand"`
+	Reserved       int       `gorm:"column:Reserved" json:"Reserved"`
+	ReservationID  string    `gorm:"column:ReservationId;type:varchar" json:"ReservationId,omitempty"`
+	CreatedAt      time.Time `gorm:"column:CreatedAt" json:"CreatedAt"`
+}
+
+// TableName maps the model onto the StockMovements table
+func (StockMovement) TableName() string {
+	return "StockMovements"
+}
+
+// Stock movement list holds one page of the ledger of a product
+type StockMovementList struct {
+	Items []StockMovement `json:"Items"`
+	Meta  *ListMeta       `json:"Meta,omitempty"`
+}
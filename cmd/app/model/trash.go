@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Trash models
+// Deleted products and options stay in the trash, hidden from every other read,
+// until they are restored or purged once the retention window has passed
+
+// PurgeResult reports what a purge removed for good
+type PurgeResult struct {
+	Before   time.Time `json:"Before"`
+	Products int       `json:"Products"`
+	Options  int       `json:"Options"`
+}
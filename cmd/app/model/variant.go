@@ -0,0 +1,86 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Variant models
+// Options sharing a Group are the values of one attribute of a product, like
+// Size: S, M, L, and a variant is one combination of a value from every group
+// with its own SKU, price and enabled flag
+// Options without a group are add-ons and take no part in variants
+
+// MaxVariants caps the number of combinations generated for one product
+const MaxVariants = 1000
+
+// OptionGroup is an attribute of a product with the options as its values
+type OptionGroup struct {
+	Name    string          `json:"Name"`
+	Options []ProductOption `json:"Options"`
+}
+
+// ProductVariant is one combination of options from every group of a product
+type ProductVariant struct {
+	ID        string `gorm:"column:Id;type:varchar;primary_key" json:"Id"`
+	ProductID string `gorm:"column:ProductId;type:varchar" json:"ProductId"`
+	Sku       string `gorm:"column:Sku;type:varchar" json:"Sku"`
+	OptionIDs IDList `gorm:"column:OptionIds;type:varchar" json:"OptionIds"`
+	Price     Money  `gorm:"column:Price;type:decimal(12,3)" json:"Price"`
+	Enabled   bool   `gorm:"column:Enabled" json:"Enabled"`
+}
+
+// TableName maps the model onto the ProductVariants table
+func (ProductVariant) TableName() string {
+	return "ProductVariants"
+}
+
+// Product variant list holds an array of product variant models
+type ProductVariantList struct {
+	Items []ProductVariant `json:"Items"`
+}
+
+// IDList is a set of IDs kept sorted, stored as a comma separated column
+// so the same combination always has the same value
+type IDList []string
+
+// NewIDList returns the IDs sorted
+func NewIDList(ids []string) IDList {
+	list := append(IDList(nil), ids...)
+	sort.Strings(list)
+
+	return list
+}
+
+// Value stores the IDs comma separated
+func (l IDList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// Scan reads comma separated IDs
+func (l *IDList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into IDList", src)
+	}
+
+	*l = nil
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+
+	return nil
+}
+
+// String returns the IDs comma separated
+func (l IDList) String() string {
+	return strings.Join(l, ",")
+}
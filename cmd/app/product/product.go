@@ -1,23 +1,57 @@
 package product
 
-import "../model"
+import (
+	"../model"
+	"../utils"
+)
 
 // This is the interface which acts as an abstraction layer to the business logic
 // it allows for the controlled exposure and presentation of functionality needed
 // necessary to interact with the experience layer
 type Front interface {
+	// The same functionality acting on behalf of a caller, whose role and team decide what it may change
+	As(caller *utils.Principal) Front
+
 	// Core product functionality
-	List() (model.ProductList, error)
-	ListByName(name string) (model.ProductList, error)
-	GetByID(id string) (*model.Product, error)
+	List(q model.ProductQuery) (model.ProductList, error)
+	GetByID(id string, currency string) (*model.Product, error)
 	CreateProduct(*model.Product) error
 	UpdateProduct(*model.Product) error
+	PatchProduct(id string, version int, edit func(*model.Product) error) (*model.Product, error)
 	DeleteProduct(*model.Product) error
+	Transition(id string, action string) (*model.Product, error)
+	EffectivePrice(id string, optionIDs []string, currency string) (*model.EffectivePrice, error)
 
 	// Necessary product options functionality
-	ListOptions(id string) (model.ProductOptionList, error)
+	ListOptions(id string, q model.OptionQuery) (model.ProductOptionList, error)
 	CreateOption(*model.ProductOption) error
 	GetSpecificOption(id string, optionId string) (*model.ProductOption, error)
 	UpdateSpecificOption(id string, optionId string, po *model.ProductOption) error
-	DeleteSpecificOption(id string, optionId string) error
+	PatchSpecificOption(id string, optionId string, version int, edit func(*model.ProductOption) error) (*model.ProductOption, error)
+	DeleteSpecificOption(id string, optionId string, version int) error
+
+	// Option groups and the variants combining them
+	Groups(id string) ([]model.OptionGroup, error)
+	CreateGroup(id string, group *model.OptionGroup) error
+	ListVariants(id string) (model.ProductVariantList, error)
+	GenerateVariants(id string) (model.ProductVariantList, error)
+	GetVariant(id string, variantId string) (*model.ProductVariant, error)
+	UpdateVariant(id string, variantId string, variant *model.ProductVariant) error
+	DeleteVariant(id string, variantId string) error
+
+	// Stock levels, reservations and the ledger
+	ListStock(id string) (model.StockList, error)
+	SetStock(stock *model.Stock) error
+	Reserve(reservation *model.StockReservation) error
+	GetReservation(id string, reservationId string) (*model.StockReservation, error)
+	ReleaseReservation(id string, reservationId string) (*model.StockReservation, error)
+	CommitReservation(id string, reservationId string) (*model.StockReservation, error)
+	ListMovements(id string, page model.Page) (model.StockMovementList, error)
+
+	// Trash of deleted products and options
+	ListTrash(page model.Page) (model.ProductList, error)
+	RestoreProduct(id string) (*model.Product, error)
+	PurgeProduct(id string) error
+	ListDeletedOptions(id string) (model.ProductOptionList, error)
+	RestoreOption(id string, optionId string) (*model.ProductOption, error)
 }
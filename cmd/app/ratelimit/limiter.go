@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate limiting section
+// Every request of a client takes a token from a bucket holding up to Burst tokens,
+// which refills at Rate tokens a second, and a request finding the bucket empty is refused
+// Each rule has its own buckets, kept in a Store living in process or shared between
+// the instances of the service
+
+// Limit is the size of a bucket and the rate it refills at, in tokens a second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is what a client found in its bucket
+// Reset is how long until the bucket is full again and RetryAfter, for a refused request,
+// how long until the next token
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets of the clients
+// Shared stores, backed by Redis or a database, implement it so instances of the service draw
+// from the same buckets, the key being the same on every instance running the same rules
+type Store interface {
+	// Take takes a token from the bucket of the key, refilled up to now at the rate of the limit
+	Take(key string, limit Limit, now time.Time) (Result, error)
+
+	// Peek reports what the bucket of the key holds now without taking a token
+	Peek(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Rule limits the requests of a route and methods
+// The route is a route path like /products/:id, a group of routes like /products/*, or * for
+// every route, and no methods stand for every method
+type Rule struct {
+	Route   string
+	Methods []string
+	Limit   Limit
+}
+
+// matches reports whether the rule applies to the method and route path of a request
+func (r *Rule) matches(method string, route string) bool {
+	if len(r.Methods) > 0 {
+		found := false
+		for _, m := range r.Methods {
+			found = found || m == method
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch {
+	case r.Route == "*":
+		return true
+	case strings.HasSuffix(r.Route, "/*"):
+		group := strings.TrimSuffix(r.Route, "*")
+		return route == strings.TrimSuffix(group, "/") || strings.HasPrefix(route, group)
+	}
+
+	return route == r.Route
+}
+
+// Limiter applies the first rule matching a request to the bucket the client has for that rule
+type Limiter struct {
+	store Store
+	rules []Rule
+}
+
+// NewLimiter returns a limiter keeping its buckets in the store
+func NewLimiter(store Store, rules []Rule) *Limiter {
+	return &Limiter{store: store, rules: rules}
+}
+
+// Take takes a token for the client from the bucket of the first rule matching the request
+// Requests matching no rule are not limited and come back without a result
+func (l *Limiter) Take(client string, method string, route string) (*Result, error) {
+	return l.draw(l.store.Take, client, method, route)
+}
+
+// Peek reports what the client has left in the bucket of the first rule matching the request,
+// without taking a token, so a request can be refused before any work is done for it
+func (l *Limiter) Peek(client string, method string, route string) (*Result, error) {
+	return l.draw(l.store.Peek, client, method, route)
+}
+
+// draw applies the store operation to the bucket the client has for the first rule matching the request
+func (l *Limiter) draw(op func(string, Limit, time.Time) (Result, error), client string, method string, route string) (*Result, error) {
+	for i := range l.rules {
+		rule := &l.rules[i]
+		if !rule.matches(method, route) {
+			continue
+		}
+
+		result, err := op(strconv.Itoa(i)+"|"+client, rule.Limit, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	return nil, nil
+}
+
+// duration turns a number of seconds into a duration
+func duration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the memory store drops the buckets which filled up again
+const sweepInterval = time.Minute
+
+// MemoryStore keeps the buckets in process, each instance of the service limiting on its own
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// bucket holds the tokens left when it was last drawn from, and when it is full again
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// NewMemoryStore returns an empty in process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take takes a token from the bucket of the key, a new bucket starting full
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.refill(limit, now)
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	result := b.result(limit, allowed)
+	b.full = now.Add(result.Reset)
+
+	return result, nil
+}
+
+// Peek reports what the bucket of the key holds, a missing bucket being full
+func (s *MemoryStore) Peek(key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := bucket{tokens: float64(limit.Burst), updated: now}
+	if stored, ok := s.buckets[key]; ok {
+		b = *stored
+	}
+	b.refill(limit, now)
+
+	return b.result(limit, b.tokens >= 1), nil
+}
+
+// refill adds the tokens the bucket gained since it was last drawn from, up to the burst
+func (b *bucket) refill(limit Limit, now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.updated = now
+	}
+}
+
+// result reports the tokens left in the bucket, and for a refused request how long until the next one
+func (b *bucket) result(limit Limit, allowed bool) Result {
+	result := Result{Allowed: allowed, Limit: limit.Burst, Remaining: int(b.tokens)}
+	if !allowed {
+		result.RetryAfter = duration((1 - b.tokens) / limit.Rate)
+	}
+	result.Reset = duration((float64(limit.Burst) - b.tokens) / limit.Rate)
+
+	return result
+}
+
+// sweep drops the buckets which are full again, as a new bucket would be, at most once per interval
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < sweepInterval {
+		return
+	}
+	s.swept = now
+
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"../storage"
+	"../utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// Authentication section
+// Every request has to carry a bearer JWT or an API key, reads need the read scope
+// and writes the write scope, the caller is kept on the context for the handlers
+// The public keys verifying the tokens are published without authentication
+
+// JWKSPath is where the public keys are published
+const JWKSPath = "/.well-known/jwks.json"
+
+// realm is announced to callers which are asked to authenticate
+const realm = `Bearer realm="products"`
+
+// lastUsedPrecision is how stale the last use of an API key may get before it is written again,
+// sparing a write on every request
+const lastUsedPrecision = time.Minute
+
+// Authenticate verifies the API key or bearer token of every request and checks it grants the scope the method needs
+// A request sending an API key is judged by the key alone
+func Authenticate(keyring *utils.Keyring, keys storage.APIKeyRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Path() == JWKSPath {
+				return next(c)
+			}
+
+			var principal *utils.Principal
+			if key := c.Request().Header.Get(utils.HeaderAPIKey); key != "" {
+				var err error
+				if principal, err = apiKeyPrincipal(c, keys, key); err != nil {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, realm)
+					return err
+				}
+			} else {
+				header := c.Request().Header.Get(echo.HeaderAuthorization)
+				if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, realm)
+					return utils.Unauthorized("a bearer token or an API key is required")
+				}
+
+				var err error
+				if principal, err = keyring.Verify(strings.TrimSpace(header[7:])); err != nil {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, realm+`, error="invalid_token"`)
+					return utils.Unauthorized("the bearer token is not valid: " + err.Error())
+				}
+			}
+
+			scope := requiredScope(c.Request().Method)
+			if !principal.HasScope(scope) {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, realm+`, error="insufficient_scope", scope="`+scope+`"`)
+				return utils.AccessForbidden()
+			}
+
+			c.Set(utils.PrincipalKey, principal)
+			return next(c)
+		}
+	}
+}
+
+// apiKeyPrincipal returns the caller an API key stands for, refusing unknown, revoked and disabled keys
+// The last use is recorded on the way, a failure to do so is only logged
+func apiKeyPrincipal(c echo.Context, keys storage.APIKeyRepository, key string) (*utils.Principal, error) {
+	id, hash, ok := utils.SplitAPIKey(key)
+	if !ok {
+		return nil, utils.Unauthorized("the API key is not valid")
+	}
+
+	stored, err := keys.GetAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || !utils.MatchAPIKeyHash(stored.Hash, hash) {
+		return nil, utils.Unauthorized("the API key is not valid")
+	}
+	if stored.Disabled {
+		return nil, utils.Unauthorized("the API key is disabled")
+	}
+
+	now := time.Now().UTC()
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) >= lastUsedPrecision {
+		if err = keys.TouchAPIKey(id, now); err != nil {
+			c.Logger().Warn("recording the use of API key ", id, ": ", err)
+		}
+	}
+
+	role := stored.Role
+	if role == "" {
+		role = utils.RoleViewer
+	}
+
+	return &utils.Principal{Subject: "apikey:" + stored.ID, Scopes: strings.Fields(stored.Scopes), Role: role, Team: stored.Team}, nil
+}
+
+// requiredScope returns the scope a request method needs, anything but a read is a write
+func requiredScope(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return utils.ScopeRead
+	}
+
+	return utils.ScopeWrite
+}
+
+// JWKS serves the public keys of the keyring as a JWK set
+func JWKS(keyring *utils.Keyring) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Cache-Control", "public, max-age=300")
+		return c.JSONPretty(http.StatusOK, keyring.JWKS(), " ")
+	}
+}
@@ -0,0 +1,41 @@
+package router
+
+import (
+	"../utils"
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// ErrorHandler renders every error returned by a handler or middleware as a problem document
+// Internal failures are logged with their cause while the client only sees a generic message
+func ErrorHandler(err error, c echo.Context) {
+	e := utils.NewError(err)
+
+	if e.Status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	// Nothing can be sent once the response has started
+	if c.Response().Committed {
+		return
+	}
+
+	if c.Request().Method == http.MethodHead {
+		if err = c.NoContent(e.Status); err != nil {
+			c.Logger().Error(err)
+		}
+		return
+	}
+
+	body, err := json.MarshalIndent(e.Problem(c.Request().URL.Path), "", " ")
+	if err != nil {
+		c.Logger().Error(err)
+		return
+	}
+
+	if err = c.Blob(e.Status, utils.MIMEProblemJSON, body); err != nil {
+		c.Logger().Error(err)
+	}
+}
@@ -0,0 +1,119 @@
+package router
+
+import (
+	"../ratelimit"
+	"../utils"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// Rate limiting section
+// Every request takes a token from the bucket its caller has for the rule matching it, and the
+// state of the bucket is reported in the RateLimit headers of the response
+
+// Headers reporting the bucket of the caller
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// RateLimit refuses the requests of a caller whose bucket is empty with a 429
+// A failing store lets requests through, so an outage of a shared store does not take the service down with it
+func RateLimit(limiter *ratelimit.Limiter, trustProxy bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := take(c, limiter, client(c, trustProxy)); err != nil {
+				return err
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// LimitFailures draws a token from the bucket of the address for every request refused by the
+// authentication running after it, which never reaches RateLimit, so clients sending bad or no
+// credentials are limited as well
+// An address whose bucket is empty is answered with a 429 before its credentials are checked,
+// so guessing them costs no more than the bucket allows
+func LimitFailures(limiter *ratelimit.Limiter, trustProxy bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			address := client(c, trustProxy)
+			if err := report(c, limiter.Peek, address); err != nil {
+				return err
+			}
+
+			err := next(c)
+			if err == nil || c.Get(utils.PrincipalKey) != nil {
+				return err
+			}
+
+			if limited := take(c, limiter, address); limited != nil {
+				return limited
+			}
+			return err
+		}
+	}
+}
+
+// take takes a token for the client and reports the state of its bucket in the response headers,
+// returning the error refusing the request when the bucket is empty
+func take(c echo.Context, limiter *ratelimit.Limiter, client string) error {
+	return report(c, limiter.Take, client)
+}
+
+// report draws on the bucket of the client with the limiter operation and reports its state in the
+// response headers, returning the error refusing the request when the bucket is empty
+func report(c echo.Context, draw func(string, string, string) (*ratelimit.Result, error), client string) error {
+	result, err := draw(client, c.Request().Method, c.Path())
+	if err != nil {
+		c.Logger().Warn("rate limit store: ", err)
+		return nil
+	}
+	if result == nil {
+		return nil
+	}
+
+	header := c.Response().Header()
+	header.Set(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+	header.Set(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+	header.Set(HeaderRateLimitReset, seconds(result.Reset))
+
+	if !result.Allowed {
+		retry := seconds(result.RetryAfter)
+		header.Set(HeaderRetryAfter, retry)
+		return utils.TooManyRequests(fmt.Sprintf("rate limit exceeded, retry in %ss", retry))
+	}
+
+	return nil
+}
+
+// client names the caller of a request, by API key or JWT subject once authenticated and by address otherwise
+// The address is only taken from the proxy headers when the proxy is trusted, clients could make them up
+func client(c echo.Context, trustProxy bool) string {
+	if principal, _ := c.Get(utils.PrincipalKey).(*utils.Principal); principal != nil {
+		return "sub:" + principal.Subject
+	}
+	if trustProxy {
+		return "ip:" + c.RealIP()
+	}
+
+	address, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		address = c.Request().RemoteAddr
+	}
+	return "ip:" + address
+}
+
+// seconds writes a duration in whole seconds, rounded up
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
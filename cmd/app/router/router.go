@@ -1,23 +1,57 @@
 package router
 
 import (
+	"../config"
+	"../ratelimit"
+	"../storage"
+	"../utils"
+	"strings"
+
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
-	"github.com/labstack/gommon/log"
 )
 
-func New() *echo.Echo {
+// New sets up the framework with the middleware every request goes through
+// Requests are authenticated once CORS had its say, so preflights pass without a token,
+// API keys being looked up in the given storage, and then rate limited by caller with
+// the buckets kept in the given store, the requests refused by authentication by address
+func New(cfg *config.Config, keys storage.APIKeyRepository, limits ratelimit.Store) (*echo.Echo, error) {
 	e := echo.New()
 	e.HideBanner = true
-	e.Logger.SetLevel(log.DEBUG)
+	e.HTTPErrorHandler = ErrorHandler
+	e.Logger.SetLevel(config.LogLevels[strings.ToLower(cfg.Log.Level)])
 	e.Pre(middleware.RemoveTrailingSlash())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Secure())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		AllowOrigins: cfg.CORS.AllowOrigins,
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization,
+			"If-Match", "If-None-Match", utils.HeaderAPIKey},
 		AllowMethods: []string{echo.GET, echo.HEAD, echo.PUT, echo.PATCH, echo.POST, echo.DELETE},
+		ExposeHeaders: []string{"ETag", echo.HeaderWWWAuthenticate, HeaderRateLimitLimit, HeaderRateLimitRemaining,
+			HeaderRateLimitReset, HeaderRetryAfter},
 	}))
 
-	return e
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		limiter = ratelimit.NewLimiter(limits, cfg.RateLimitRules())
+	}
+
+	if cfg.Auth.Enabled {
+		keyring, err := cfg.Keyring()
+		if err != nil {
+			return nil, err
+		}
+		if limiter != nil {
+			e.Use(LimitFailures(limiter, cfg.RateLimit.TrustProxy))
+		}
+		e.Use(Authenticate(keyring, keys))
+		e.GET(JWKSPath, JWKS(keyring))
+	}
+
+	if limiter != nil {
+		e.Use(RateLimit(limiter, cfg.RateLimit.TrustProxy))
+	}
+
+	return e, nil
 }
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"../model"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// API key storage
+// Both backends keep the keys in their own table or map, the hash of the
+// secret is stored as given and never changes
+
+func (r *GormRepository) ListAPIKeys() ([]model.APIKey, error) {
+	var keys []model.APIKey
+
+	err := r.db.Order(r.quote("CreatedAt") + ", " + r.quote("Id")).Find(&keys).Error
+
+	return keys, err
+}
+
+func (r *GormRepository) GetAPIKey(id string) (*model.APIKey, error) {
+	var key model.APIKey
+
+	err := r.db.Where(r.quote("Id")+" = ?", id).Find(&key).Error
+
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (r *GormRepository) CreateAPIKey(key *model.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *GormRepository) SetAPIKeyDisabled(id string, disabled bool) error {
+	return r.updateAPIKey(id, "Disabled", disabled)
+}
+
+func (r *GormRepository) TouchAPIKey(id string, at time.Time) error {
+	return r.updateAPIKey(id, "LastUsedAt", at)
+}
+
+func (r *GormRepository) DeleteAPIKey(id string) error {
+	res := r.db.Delete(&model.APIKey{ID: id})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// updateAPIKey writes one column of a key
+func (r *GormRepository) updateAPIKey(id string, column string, value interface{}) error {
+	res := r.db.Model(&model.APIKey{}).Where(r.quote("Id")+" = ?", id).UpdateColumn(column, value)
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ListAPIKeys() ([]model.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]model.APIKey, 0, len(r.apiKeys))
+	for _, k := range r.apiKeys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+func (r *MemoryRepository) GetAPIKey(id string) (*model.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.apiKeys[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &key, nil
+}
+
+func (r *MemoryRepository) CreateAPIKey(key *model.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.apiKeys[key.ID]; ok {
+		return ErrDuplicate
+	}
+	r.apiKeys[key.ID] = *key
+
+	return nil
+}
+
+func (r *MemoryRepository) SetAPIKeyDisabled(id string, disabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	key.Disabled = disabled
+	r.apiKeys[id] = key
+
+	return nil
+}
+
+func (r *MemoryRepository) TouchAPIKey(id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	key.LastUsedAt = &at
+	r.apiKeys[id] = key
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteAPIKey(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.apiKeys[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.apiKeys, id)
+
+	return nil
+}
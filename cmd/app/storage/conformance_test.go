@@ -0,0 +1,654 @@
+package storage
+
+import (
+	"../model"
+	"../utils"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Repository conformance suite
+// Runs the whole repository surface against a backend and fails on the first
+// behaviour which differs from the contract, so every backend is verified the same way
+// Only records created by the suite are touched and they are removed again,
+// apart from the stock ledger which outlives its products
+
+// runConformance exercises the repository, one subtest per part of the contract
+// The subtests share a product and build on each other, so the first failure stops the run
+func runConformance(t *testing.T, repo Repository) {
+	id := utils.GenerateUUID()
+	name := "check-" + id[:8]
+	var optionID string
+
+	steps := []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{"products", func(t *testing.T) { checkProducts(t, repo, id, name) }},
+		{"status", func(t *testing.T) { checkStatus(t, repo, id, name+"u") }},
+		{"search", func(t *testing.T) { expectNoError(t, checkSearch(repo, id, name+"u")) }},
+		{"options", func(t *testing.T) { optionID = checkOptions(t, repo, id) }},
+		{"paging", func(t *testing.T) { expectNoError(t, checkPaging(repo, "page-"+id[:8])) }},
+		{"prices", func(t *testing.T) { expectNoError(t, checkPrices(repo, id)) }},
+		{"variants", func(t *testing.T) { expectNoError(t, checkVariants(repo, id)) }},
+		{"stock", func(t *testing.T) { expectNoError(t, checkStock(repo, id)) }},
+		{"trash", func(t *testing.T) { expectNoError(t, checkTrash(repo, id, optionID)) }},
+		{"integrity", func(t *testing.T) { expectNoError(t, checkIntegrity(repo, id)) }},
+		{"api keys", func(t *testing.T) { expectNoError(t, checkAPIKeys(repo)) }},
+		{"removal", func(t *testing.T) { checkRemoval(t, repo, id) }},
+	}
+
+	for _, step := range steps {
+		if !t.Run(step.name, step.run) {
+			return
+		}
+	}
+}
+
+// expectNoError fails the test with the error of a check
+func expectNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkProducts creates, reads, lists and replaces the product
+func checkProducts(t *testing.T, repo Repository, id string, name string) {
+	product := model.Product{ID: id, Name: name, Description: "conformance", Price: 12500, DeliveryPrice: 1250, Status: model.StatusDraft,
+		Team: "check", Owner: "check"}
+	if err := repo.CreateProduct(&product); err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+
+	got, err := repo.GetProduct(id)
+	if err != nil || got == nil {
+		t.Fatalf("get product: %v %v", got, err)
+	}
+	if got.Name != name || got.Description != "conformance" || got.Price != 12500 || got.DeliveryPrice != 1250 ||
+		got.Team != "check" || got.Owner != "check" {
+		t.Fatalf("get product returned %+v", *got)
+	}
+
+	if missing, err := repo.GetProduct(utils.GenerateUUID()); missing != nil || err != nil {
+		t.Fatalf("get missing product: %v %v", missing, err)
+	}
+
+	if err = expectProducts(repo, model.ProductQuery{}, id, true); err != nil {
+		t.Fatalf("list products: %v", err)
+	}
+	if err = expectProducts(repo, model.ProductQuery{Name: name}, id, true); err != nil {
+		t.Fatalf("list products by name: %v", err)
+	}
+
+	if got.Version != model.FirstVersion {
+		t.Fatalf("new product is at version %d", got.Version)
+	}
+	update := model.Product{ID: id, Name: name + "u", Description: "conformance", Price: 12500, DeliveryPrice: 1250, Team: "moved", Version: model.FirstVersion}
+	if err = repo.ReplaceProduct(&update); err != nil || update.Version != model.FirstVersion+1 {
+		t.Fatalf("replace product: version %d %v", update.Version, err)
+	}
+	if got, err = repo.GetProduct(id); err != nil || got == nil || got.Name != name+"u" || got.Price != 12500 || got.Version != update.Version ||
+		got.Team != "moved" || got.Owner != "check" {
+		t.Fatalf("get replaced product: %v %v", got, err)
+	}
+	if err = repo.ReplaceProduct(&model.Product{ID: id, Name: "stale", Version: model.FirstVersion}); err != ErrVersionMismatch {
+		t.Fatalf("replace product at a stale version: expected a version mismatch, got %v", err)
+	}
+	if err = repo.DeleteProduct(id, model.FirstVersion); err != ErrVersionMismatch {
+		t.Fatalf("delete product at a stale version: expected a version mismatch, got %v", err)
+	}
+	if err = repo.ReplaceProduct(&model.Product{ID: utils.GenerateUUID(), Name: "x"}); err != ErrNotFound {
+		t.Fatalf("replace missing product: expected not found, got %v", err)
+	}
+}
+
+// checkStatus publishes the draft product, only moving it from the status it is in
+func checkStatus(t *testing.T, repo Repository, id string, name string) {
+	before, err := repo.GetProduct(id)
+	if err != nil || before == nil {
+		t.Fatalf("get product: %v %v", before, err)
+	}
+
+	published := model.ProductQuery{Name: name, Statuses: []string{model.StatusPublished}}
+	if err = expectProducts(repo, published, id, false); err != nil {
+		t.Fatalf("list published products: %v", err)
+	}
+	if err = repo.SetProductStatus(id, model.StatusArchived, model.StatusDraft); err != ErrNotFound {
+		t.Fatalf("set status from another status: expected not found, got %v", err)
+	}
+	if err = repo.SetProductStatus(id, model.StatusDraft, model.StatusPublished); err != nil {
+		t.Fatalf("set status: %v", err)
+	}
+	if got, err := repo.GetProduct(id); err != nil || got == nil || got.Version != before.Version+1 {
+		t.Fatalf("get product after a status change: %v %v", got, err)
+	}
+	if err = expectProducts(repo, published, id, true); err != nil {
+		t.Fatalf("list published products: %v", err)
+	}
+}
+
+// checkOptions stores, filters, replaces and deletes an option, returning its ID
+func checkOptions(t *testing.T, repo Repository, id string) string {
+	option := model.ProductOption{ID: utils.GenerateUUID(), ProductID: id, Name: "Silver", Description: "conformance",
+		PriceMode: model.AdjustDelta, PriceAdjustment: -1500, DeliveryPriceMode: model.AdjustOverride}
+	if err := repo.CreateOption(&option); err != nil {
+		t.Fatalf("create option: %v", err)
+	}
+
+	options, total, err := repo.ListOptions(id, model.OptionQuery{})
+	if err != nil || total != 1 || len(options) != 1 || options[0].ID != option.ID {
+		t.Fatalf("list options: %v %v", options, err)
+	}
+	if o := options[0]; o.PriceMode != model.AdjustDelta || o.PriceAdjustment != -1500 || o.DeliveryPriceMode != model.AdjustOverride || o.DeliveryPriceAdjustment != 0 {
+		t.Fatalf("list options returned adjustments %+v", o)
+	}
+
+	optionFilter := model.Filter{{Field: "Name", Op: model.OpPrefix, Value: "SIL"}}
+	if options, total, err = repo.ListOptions(id, model.OptionQuery{Filter: optionFilter}); err != nil || total != 1 {
+		t.Fatalf("filter options: %v %v", options, err)
+	}
+	if err = expectProducts(repo, model.ProductQuery{Filter: model.Filter{{Field: model.FieldHasOptions, Op: model.OpEq, Value: true}}}, id, true); err != nil {
+		t.Fatalf("filter products with options: %v", err)
+	}
+
+	// Replacing writes the zero values too
+	optionUpdate := model.ProductOption{Name: "Gold", PriceMode: model.AdjustDelta, Version: model.FirstVersion}
+	if err = repo.ReplaceOption(id, option.ID, &optionUpdate); err != nil || optionUpdate.Version != model.FirstVersion+1 {
+		t.Fatalf("replace option: version %d %v", optionUpdate.Version, err)
+	}
+	gotOption, err := repo.GetOption(id, option.ID)
+	if err != nil || gotOption == nil || gotOption.Name != "Gold" || gotOption.Description != "" || gotOption.PriceAdjustment != 0 ||
+		gotOption.DeliveryPriceMode != "" || gotOption.Version != optionUpdate.Version {
+		t.Fatalf("get replaced option: %v %v", gotOption, err)
+	}
+	if err = repo.ReplaceOption(id, option.ID, &model.ProductOption{Name: "x", Version: model.FirstVersion}); err != ErrVersionMismatch {
+		t.Fatalf("replace option at a stale version: expected a version mismatch, got %v", err)
+	}
+	if gotOption, err = repo.GetOption(utils.GenerateUUID(), option.ID); gotOption != nil || err != nil {
+		t.Fatalf("get option of another product: %v %v", gotOption, err)
+	}
+	if err = repo.ReplaceOption(utils.GenerateUUID(), option.ID, &model.ProductOption{Name: "x"}); err != ErrNotFound {
+		t.Fatalf("replace option of another product: expected not found, got %v", err)
+	}
+
+	if err = repo.DeleteOption(utils.GenerateUUID(), option.ID, 0); err != ErrNotFound {
+		t.Fatalf("delete option of another product: expected not found, got %v", err)
+	}
+	if err = repo.DeleteOption(id, option.ID, model.FirstVersion); err != ErrVersionMismatch {
+		t.Fatalf("delete option at a stale version: expected a version mismatch, got %v", err)
+	}
+	if err = repo.DeleteOption(id, option.ID, optionUpdate.Version); err != nil {
+		t.Fatalf("delete option: %v", err)
+	}
+	if err = repo.DeleteOption(id, option.ID, 0); err != ErrNotFound {
+		t.Fatalf("delete deleted option: expected not found, got %v", err)
+	}
+
+	return option.ID
+}
+
+// checkRemoval deletes and purges the product, taking the remaining prices, variants and stock along
+func checkRemoval(t *testing.T, repo Repository, id string) {
+	if err := repo.DeleteProduct(id, 0); err != nil {
+		t.Fatalf("delete product: %v", err)
+	}
+	if got, err := repo.GetProduct(id); got != nil || err != nil {
+		t.Fatalf("get deleted product: %v %v", got, err)
+	}
+	if err := repo.DeleteProduct(id, 0); err != ErrNotFound {
+		t.Fatalf("delete deleted product: expected not found, got %v", err)
+	}
+	if err := repo.PurgeProduct(id); err != nil {
+		t.Fatalf("purge product: %v", err)
+	}
+	if levels, err := repo.ListStock(id); err != nil || len(levels) != 0 {
+		t.Fatalf("stock of purged product: %v %v", levels, err)
+	}
+	if err := repo.RestoreProduct(id); err != ErrNotFound {
+		t.Fatalf("restore purged product: expected not found, got %v", err)
+	}
+}
+
+// checkAPIKeys stores, disables, touches and revokes an API key
+func checkAPIKeys(repo Repository) error {
+	key := model.APIKey{ID: utils.GenerateUUID(), Name: "check", Hash: "hash", Scopes: utils.ScopeRead,
+		Role: utils.RoleEditor, Team: "check", CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := repo.CreateAPIKey(&key); err != nil {
+		return fmt.Errorf("create key: %v", err)
+	}
+	defer repo.DeleteAPIKey(key.ID)
+
+	got, err := repo.GetAPIKey(key.ID)
+	if err != nil || got == nil || got.Hash != "hash" || got.Scopes != utils.ScopeRead || got.Role != utils.RoleEditor || got.Team != "check" || got.Disabled || got.LastUsedAt != nil {
+		return fmt.Errorf("get key: %v %v", got, err)
+	}
+	keys, err := repo.ListAPIKeys()
+	found := false
+	for _, k := range keys {
+		found = found || k.ID == key.ID
+	}
+	if err != nil || !found {
+		return fmt.Errorf("list keys: %v %v", keys, err)
+	}
+
+	used := time.Now().UTC().Truncate(time.Second)
+	if err = repo.TouchAPIKey(key.ID, used); err != nil {
+		return fmt.Errorf("touch key: %v", err)
+	}
+	if err = repo.SetAPIKeyDisabled(key.ID, true); err != nil {
+		return fmt.Errorf("disable key: %v", err)
+	}
+	if got, err = repo.GetAPIKey(key.ID); err != nil || got == nil || !got.Disabled || got.LastUsedAt == nil || !got.LastUsedAt.Equal(used) {
+		return fmt.Errorf("get disabled key: %v %v", got, err)
+	}
+
+	if err = repo.SetAPIKeyDisabled(utils.GenerateUUID(), true); err != ErrNotFound {
+		return fmt.Errorf("disable missing key: expected not found, got %v", err)
+	}
+	if err = repo.DeleteAPIKey(key.ID); err != nil {
+		return fmt.Errorf("revoke key: %v", err)
+	}
+	if got, err = repo.GetAPIKey(key.ID); got != nil || err != nil {
+		return fmt.Errorf("get revoked key: %v %v", got, err)
+	}
+	if err = repo.DeleteAPIKey(key.ID); err != ErrNotFound {
+		return fmt.Errorf("revoke revoked key: expected not found, got %v", err)
+	}
+
+	return nil
+}
+
+// checkTrash deletes and restores the product along with its options
+// The option was deleted on its own before, so it only comes back by itself
+func checkTrash(repo Repository, id string, optionID string) error {
+	added := model.ProductOption{ID: utils.GenerateUUID(), ProductID: id, Name: "Bronze"}
+	if err := repo.CreateOption(&added); err != nil {
+		return fmt.Errorf("create option: %v", err)
+	}
+	if err := repo.RestoreProduct(id); err != ErrNotFound {
+		return fmt.Errorf("restore live product: expected not found, got %v", err)
+	}
+
+	if err := repo.DeleteProduct(id, 0); err != nil {
+		return fmt.Errorf("delete product: %v", err)
+	}
+	deleted, total, err := repo.ListDeletedProducts(model.Page{Limit: model.MaxLimit})
+	found := false
+	for _, p := range deleted {
+		found = found || (p.ID == id && p.DeletedAt != nil)
+	}
+	if err != nil || total < 1 || !found {
+		return fmt.Errorf("list deleted products: %v %v", deleted, err)
+	}
+	if options, _, err := repo.ListOptions(id, model.OptionQuery{}); err != nil || len(options) != 0 {
+		return fmt.Errorf("list options of deleted product: %v %v", options, err)
+	}
+
+	if err = repo.RestoreProduct(id); err != nil {
+		return fmt.Errorf("restore product: %v", err)
+	}
+	if got, err := repo.GetProduct(id); err != nil || got == nil || got.DeletedAt != nil {
+		return fmt.Errorf("get restored product: %v %v", got, err)
+	}
+	options, _, err := repo.ListOptions(id, model.OptionQuery{})
+	if err != nil || len(options) != 1 || options[0].ID != added.ID {
+		return fmt.Errorf("list options of restored product: %v %v", options, err)
+	}
+
+	trashed, err := repo.ListDeletedOptions(id)
+	if err != nil || len(trashed) != 1 || trashed[0].ID != optionID {
+		return fmt.Errorf("list deleted options: %v %v", trashed, err)
+	}
+	if err = repo.RestoreOption(id, optionID); err != nil {
+		return fmt.Errorf("restore option: %v", err)
+	}
+	if got, err := repo.GetOption(id, optionID); err != nil || got == nil {
+		return fmt.Errorf("get restored option: %v %v", got, err)
+	}
+
+	// Nothing was deleted before the beginning of time
+	if result, err := repo.Purge(time.Time{}); err != nil || result.Products != 0 || result.Options != 0 {
+		return fmt.Errorf("purge: %+v %v", result, err)
+	}
+
+	return nil
+}
+
+// checkIntegrity makes sure options only belong to existing products and batched writes
+// are stored as a whole or not at all
+func checkIntegrity(repo Repository, id string) error {
+	missing := utils.GenerateUUID()
+	if err := repo.CreateOption(&model.ProductOption{ID: utils.GenerateUUID(), ProductID: missing, Name: "x"}); err != ErrNotFound {
+		return fmt.Errorf("create option of a missing product: expected not found, got %v", err)
+	}
+	if err := repo.CreateOptions(missing, []model.ProductOption{{ID: utils.GenerateUUID(), Name: "x"}}); err != ErrNotFound {
+		return fmt.Errorf("create options of a missing product: expected not found, got %v", err)
+	}
+
+	_, before, err := repo.ListOptions(id, model.OptionQuery{})
+	if err != nil {
+		return fmt.Errorf("list options: %v", err)
+	}
+	taken := utils.GenerateUUID()
+	clash := []model.ProductOption{{ID: taken, Name: "S", Group: "Size"}, {ID: taken, Name: "M", Group: "Size"}}
+	if err = repo.CreateOptions(id, clash); err == nil {
+		return fmt.Errorf("create options sharing an ID: expected an error")
+	}
+	if _, total, err := repo.ListOptions(id, model.OptionQuery{}); err != nil || total != before {
+		return fmt.Errorf("list options after a refused batch: %d %v", total, err)
+	}
+	batch := []model.ProductOption{{ID: utils.GenerateUUID(), Name: "S", Group: "Size"}, {ID: utils.GenerateUUID(), Name: "M", Group: "Size"}}
+	if err = repo.CreateOptions(id, batch); err != nil {
+		return fmt.Errorf("create options: %v", err)
+	}
+	if got, err := repo.GetOption(id, batch[1].ID); err != nil || got == nil || got.Group != "Size" {
+		return fmt.Errorf("get batched option: %v %v", got, err)
+	}
+
+	// Generating refuses a taken SKU without disabling anything
+	sku := "CHECK-" + id[:8] + "-G"
+	old := model.ProductVariant{ID: utils.GenerateUUID(), ProductID: id, Sku: sku + "1", OptionIDs: model.IDList{"f"}, Enabled: true}
+	if err = repo.CreateVariants([]model.ProductVariant{old}); err != nil {
+		return fmt.Errorf("create variant: %v", err)
+	}
+	fresh := model.ProductVariant{ID: utils.GenerateUUID(), ProductID: id, Sku: sku + "1", OptionIDs: model.IDList{"g"}, Enabled: true}
+	if err = repo.GenerateVariants(id, []string{old.ID}, []model.ProductVariant{fresh}); err != ErrDuplicate {
+		return fmt.Errorf("generate variant with a taken sku: expected duplicate, got %v", err)
+	}
+	if got, err := repo.GetVariant(id, old.ID); err != nil || got == nil || !got.Enabled {
+		return fmt.Errorf("get variant after a refused generation: %v %v", got, err)
+	}
+	fresh.Sku = sku + "2"
+	if err = repo.GenerateVariants(id, []string{old.ID}, []model.ProductVariant{fresh}); err != nil {
+		return fmt.Errorf("generate variants: %v", err)
+	}
+	if got, err := repo.GetVariant(id, old.ID); err != nil || got == nil || got.Enabled {
+		return fmt.Errorf("get disabled variant: %v %v", got, err)
+	}
+	if got, err := repo.GetVariant(id, fresh.ID); err != nil || got == nil || !got.Enabled {
+		return fmt.Errorf("get generated variant: %v %v", got, err)
+	}
+
+	if _, err = repo.Orphans(); err != nil {
+		return fmt.Errorf("orphans: %v", err)
+	}
+
+	return nil
+}
+
+// checkPaging lists a few products sharing a name page by page, by offset and by cursor
+func checkPaging(repo Repository, name string) error {
+	var ids []string
+	for _, price := range []model.Money{3000, 1000, 2000} {
+		p := model.Product{ID: utils.GenerateUUID(), Name: name, Price: price, DeliveryPrice: 1000}
+		if err := repo.CreateProduct(&p); err != nil {
+			return err
+		}
+		ids = append(ids, p.ID)
+	}
+	defer func() {
+		for _, id := range ids {
+			repo.DeleteProduct(id, 0)
+			repo.PurgeProduct(id)
+		}
+	}()
+
+	q := model.ProductQuery{Name: name, Sort: model.Sort{Field: "Price", Desc: true}, Page: model.Page{Limit: 2}}
+	first, total, err := repo.ListProducts(q)
+	if err != nil || total != 3 || len(first) != 2 || first[0].Price != 3000 || first[1].Price != 2000 {
+		return fmt.Errorf("first page %v total %d: %v", first, total, err)
+	}
+
+	last := first[1]
+	q.Page.Cursor = &model.Cursor{Field: "Price", Desc: true, Value: last.SortValue("Price"), ID: last.ID}
+	next, total, err := repo.ListProducts(q)
+	if err != nil || total != 3 || len(next) != 1 || next[0].Price != 1000 {
+		return fmt.Errorf("cursor page %v total %d: %v", next, total, err)
+	}
+
+	q.Page = model.Page{Limit: 2, Offset: 2}
+	tail, _, err := repo.ListProducts(q)
+	if err != nil || len(tail) != 1 || tail[0].Price != 1000 {
+		return fmt.Errorf("offset page %v: %v", tail, err)
+	}
+
+	// Filters narrow the listing and the total down
+	q = model.ProductQuery{Name: name, Filter: model.Filter{
+		{Field: "Price", Op: model.OpGte, Value: 2.0},
+		{Field: "Price", Op: model.OpLt, Value: 3.0},
+		{Field: model.FieldHasOptions, Op: model.OpEq, Value: false},
+	}}
+	filtered, total, err := repo.ListProducts(q)
+	if err != nil || total != 1 || len(filtered) != 1 || filtered[0].Price != 2000 {
+		return fmt.Errorf("filtered page %v total %d: %v", filtered, total, err)
+	}
+
+	q.Filter = model.Filter{{Field: model.FieldHasOptions, Op: model.OpEq, Value: true}}
+	if filtered, total, err = repo.ListProducts(q); err != nil || total != 0 {
+		return fmt.Errorf("products with options %v total %d: %v", filtered, total, err)
+	}
+
+	return nil
+}
+
+// checkPrices replaces and clears the explicit prices of a product along with its other fields
+func checkPrices(repo Repository, id string) error {
+	got, err := repo.GetProduct(id)
+	if err != nil || got == nil {
+		return fmt.Errorf("get product: %v %v", got, err)
+	}
+
+	prices := []model.ProductPrice{
+		{Currency: "GBP", Price: 9500, DeliveryPrice: 1000},
+		{Currency: "EUR", Price: 11250, DeliveryPrice: 1100},
+	}
+	replace := model.Product{ID: id, Name: got.Name, Description: got.Description, Price: got.Price, DeliveryPrice: got.DeliveryPrice, Prices: prices}
+	if err = repo.ReplaceProduct(&replace); err != nil {
+		return fmt.Errorf("set prices: %v", err)
+	}
+
+	got, err = repo.GetProduct(id)
+	if err != nil || got == nil || len(got.Prices) != 2 || got.Prices[0].Currency != "EUR" || got.Prices[0].Price != 11250 || got.Prices[1].DeliveryPrice != 1000 {
+		return fmt.Errorf("get prices: %v %v", got, err)
+	}
+	products, _, err := repo.ListProducts(model.ProductQuery{Name: got.Name})
+	if err != nil || len(products) != 1 || len(products[0].Prices) != 2 || products[0].Prices[1].Currency != "GBP" {
+		return fmt.Errorf("list prices: %v %v", products, err)
+	}
+
+	// Fields and prices left out are cleared
+	if err = repo.ReplaceProduct(&model.Product{ID: id, Name: got.Name, Price: got.Price}); err != nil {
+		return fmt.Errorf("clear prices: %v", err)
+	}
+	if got, err = repo.GetProduct(id); err != nil || got == nil || len(got.Prices) != 0 || got.Description != "" || got.DeliveryPrice != 0 {
+		return fmt.Errorf("get cleared prices: %v %v", got, err)
+	}
+
+	replace.Prices = prices[:1]
+	replace.Version = 0
+	return repo.ReplaceProduct(&replace)
+}
+
+// checkVariants stores, updates and removes variants, keeping their SKUs unique
+func checkVariants(repo Repository, id string) error {
+	sku := "CHECK-" + id[:8]
+	variants := []model.ProductVariant{
+		{ID: utils.GenerateUUID(), ProductID: id, Sku: sku + "-B", OptionIDs: model.NewIDList([]string{"b", "a"}), Price: 1000, Enabled: true},
+		{ID: utils.GenerateUUID(), ProductID: id, Sku: sku + "-A", OptionIDs: model.NewIDList([]string{"c"}), Price: 2000},
+	}
+	if err := repo.CreateVariants(variants); err != nil {
+		return fmt.Errorf("create variants: %v", err)
+	}
+
+	list, err := repo.ListVariants(id)
+	if err != nil || len(list) != 2 || list[0].Sku != sku+"-A" || list[1].OptionIDs.String() != "a,b" || !list[1].Enabled {
+		return fmt.Errorf("list variants: %v %v", list, err)
+	}
+
+	// A batch with a taken SKU is refused as a whole
+	clash := []model.ProductVariant{
+		{ID: utils.GenerateUUID(), ProductID: id, Sku: sku + "-C", OptionIDs: model.IDList{"d"}},
+		{ID: utils.GenerateUUID(), ProductID: id, Sku: sku + "-A", OptionIDs: model.IDList{"e"}},
+	}
+	if err = repo.CreateVariants(clash); err != ErrDuplicate {
+		return fmt.Errorf("create variant with a taken sku: expected duplicate, got %v", err)
+	}
+	if list, err = repo.ListVariants(id); err != nil || len(list) != 2 {
+		return fmt.Errorf("list variants after a refused batch: %v %v", list, err)
+	}
+
+	// Updates write zero values too
+	if err = repo.UpdateVariant(id, variants[0].ID, &model.ProductVariant{Sku: sku + "-A"}); err != ErrDuplicate {
+		return fmt.Errorf("update variant to a taken sku: expected duplicate, got %v", err)
+	}
+	if err = repo.UpdateVariant(id, variants[0].ID, &model.ProductVariant{Sku: sku + "-D"}); err != nil {
+		return fmt.Errorf("update variant: %v", err)
+	}
+	got, err := repo.GetVariant(id, variants[0].ID)
+	if err != nil || got == nil || got.Sku != sku+"-D" || got.Price != 0 || got.Enabled {
+		return fmt.Errorf("get updated variant: %v %v", got, err)
+	}
+	if got, err = repo.GetVariant(utils.GenerateUUID(), variants[0].ID); got != nil || err != nil {
+		return fmt.Errorf("get variant of another product: %v %v", got, err)
+	}
+
+	if err = repo.DeleteVariant(id, variants[0].ID); err != nil {
+		return fmt.Errorf("delete variant: %v", err)
+	}
+	if err = repo.DeleteVariant(id, variants[0].ID); err != ErrNotFound {
+		return fmt.Errorf("delete deleted variant: expected not found, got %v", err)
+	}
+
+	return nil
+}
+
+// checkStock sets a stock level and runs reservations against it, following the ledger
+func checkStock(repo Repository, id string) error {
+	inStock := model.Filter{{Field: model.FieldInStock, Op: model.OpEq, Value: true}}
+	if err := expectProducts(repo, model.ProductQuery{Filter: inStock}, id, false); err != nil {
+		return fmt.Errorf("filter before stock: %v", err)
+	}
+
+	missing := model.StockReservation{ID: utils.GenerateUUID(), ProductID: id, Quantity: 1}
+	if err := repo.Reserve(&missing); err != ErrNotFound {
+		return fmt.Errorf("reserve untracked stock: expected not found, got %v", err)
+	}
+
+	stock := model.Stock{ProductID: id, OnHand: 5, LowStockThreshold: 2}
+	if err := repo.SetStock(&stock); err != nil || stock.Available != 5 || stock.Low {
+		return fmt.Errorf("set stock: %+v %v", stock, err)
+	}
+	if err := expectProducts(repo, model.ProductQuery{Filter: inStock}, id, true); err != nil {
+		return fmt.Errorf("filter in stock: %v", err)
+	}
+
+	// Reservations take what is available and no more
+	first := model.StockReservation{ID: utils.GenerateUUID(), ProductID: id, Quantity: 4}
+	if err := repo.Reserve(&first); err != nil || first.Status != model.ReservationOpen {
+		return fmt.Errorf("reserve: %+v %v", first, err)
+	}
+	second := model.StockReservation{ID: utils.GenerateUUID(), ProductID: id, Quantity: 2}
+	if err := repo.Reserve(&second); err != ErrInsufficientStock {
+		return fmt.Errorf("reserve too much: expected insufficient stock, got %v", err)
+	}
+	if err := repo.SetStock(&model.Stock{ProductID: id, OnHand: 3, LowStockThreshold: 2}); err != ErrInsufficientStock {
+		return fmt.Errorf("set stock below reserved: expected insufficient stock, got %v", err)
+	}
+	lowStock := model.Filter{{Field: model.FieldLowStock, Op: model.OpEq, Value: true}}
+	if err := expectProducts(repo, model.ProductQuery{Filter: lowStock}, id, true); err != nil {
+		return fmt.Errorf("filter low stock: %v", err)
+	}
+
+	got, err := repo.GetReservation(id, first.ID)
+	if err != nil || got == nil || got.Quantity != 4 {
+		return fmt.Errorf("get reservation: %v %v", got, err)
+	}
+	if got, err = repo.GetReservation(utils.GenerateUUID(), first.ID); got != nil || err != nil {
+		return fmt.Errorf("get reservation of another product: %v %v", got, err)
+	}
+
+	if got, err = repo.CloseReservation(id, first.ID, model.ReservationCommitted); err != nil || got.Status != model.ReservationCommitted {
+		return fmt.Errorf("commit reservation: %v %v", got, err)
+	}
+	if _, err = repo.CloseReservation(id, first.ID, model.ReservationReleased); err != ErrReservationClosed {
+		return fmt.Errorf("release committed reservation: expected closed, got %v", err)
+	}
+	second.Quantity = 1
+	if err = repo.Reserve(&second); err != nil {
+		return fmt.Errorf("reserve again: %v", err)
+	}
+	if _, err = repo.CloseReservation(id, second.ID, model.ReservationReleased); err != nil {
+		return fmt.Errorf("release reservation: %v", err)
+	}
+
+	levels, err := repo.ListStock(id)
+	if err != nil || len(levels) != 1 || levels[0].OnHand != 1 || levels[0].Reserved != 0 || !levels[0].Low {
+		return fmt.Errorf("list stock: %v %v", levels, err)
+	}
+
+	// Every change is in the ledger, oldest first
+	movements, total, err := repo.ListMovements(id, model.Page{Limit: 10})
+	kinds := make([]string, 0, len(movements))
+	for _, m := range movements {
+		kinds = append(kinds, m.Kind)
+	}
+	if err != nil || total != 5 || strings.Join(kinds, ",") != "adjust,reserve,commit,reserve,release" || movements[2].OnHand != 1 {
+		return fmt.Errorf("list movements: %v total %d: %v", movements, total, err)
+	}
+
+	return nil
+}
+
+// checkSearch looks the product up with every search mode
+func checkSearch(repo Repository, id string, name string) error {
+	searches := []struct {
+		search  model.Search
+		present bool
+	}{
+		{model.Search{Term: name, Mode: model.SearchExact}, true},
+		{model.Search{Term: strings.ToUpper(name), Mode: model.SearchExact}, false},
+		{model.Search{Term: strings.ToUpper(name[:7]), Mode: model.SearchPrefix}, true},
+		{model.Search{Term: name[6:], Mode: model.SearchPrefix}, false},
+		{model.Search{Term: strings.ToUpper(name[3:]), Mode: model.SearchContains}, true},
+		{model.Search{Term: "CONFORMANCE", Mode: model.SearchFullText}, true},
+		{model.Search{Term: "conformance", Mode: model.SearchFullText, Fields: []string{"Name"}}, false},
+		{model.Search{Term: "conformance missing", Mode: model.SearchFullText}, false},
+	}
+
+	for _, s := range searches {
+		s := s
+		q := model.ProductQuery{Search: &s.search, Sort: model.Sort{Field: model.SortRelevance, Desc: true}}
+		if s.search.Mode != model.SearchFullText {
+			q.Sort = model.Sort{}
+		}
+		if err := expectProducts(repo, q, id, s.present); err != nil {
+			return fmt.Errorf("%s %q in %v: %v", s.search.Mode, s.search.Term, s.search.Fields, err)
+		}
+	}
+
+	return nil
+}
+
+// expectProducts checks whether the listing contains the product with the given ID
+func expectProducts(repo Repository, q model.ProductQuery, id string, present bool) error {
+	products, _, err := repo.ListProducts(q)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, p := range products {
+		if p.ID == id {
+			found = true
+		}
+	}
+
+	if found != present {
+		return fmt.Errorf("product %s present: %v, expected %v", id, found, present)
+	}
+
+	return nil
+}
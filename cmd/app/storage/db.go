@@ -1,42 +1,109 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
-// New constructor for the DB
-func New() *gorm.DB {
+// SQL dialects the service can run against
+const (
+	DialectSQLite   = "sqlite3"
+	DialectPostgres = "postgres"
+)
+
+// Location of the SQLite data source used when no DSN is given
+const DefaultDSN = "./data/products.db"
+
+// DialectFor works out the SQL dialect from the shape of the data source name
+// Postgres URLs and key/value connection strings select Postgres, anything else is a SQLite file
+func DialectFor(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") ||
+		strings.Contains(dsn, "host=") || strings.Contains(dsn, "dbname=") {
+		return DialectPostgres
+	}
+
+	return DialectSQLite
+}
+
+// New constructor for the DB, the dialect is picked from the data source name
+// Every statement is logged when logSQL is set, which is meant for debugging only
+func New(dsn string, logSQL bool) (*gorm.DB, error) {
+	if dsn == "" {
+		dsn = DefaultDSN
+	}
+	dialect := DialectFor(dsn)
+
+	// Make sure the data directory exists so a fresh checkout can boot
+	if dialect == DialectSQLite {
+		if err := os.MkdirAll(filepath.Dir(dsn), 0755); err != nil {
+			return nil, fmt.Errorf("storage error: %v", err)
+		}
+	}
+
+	// SQLite only enforces the foreign keys of the schema when asked to on every connection,
+	// and writers wait for each other instead of failing with database is locked
+	if dialect == DialectSQLite {
+		dsn = sqliteOptions(dsn)
+	}
+
 	// Start a new connection with data source
-	db, err := gorm.Open("sqlite3", "./data/products.db")
+	db, err := gorm.Open(dialect, dsn)
 
 	// Check for errors
 	if err != nil {
 
-		// Output issues
-		fmt.Println("Storage Error: ", err)
+		// Surface issues
+		return nil, fmt.Errorf("storage error: %v", err)
 	}
 
 	// Set number of connection
 	db.DB().SetMaxIdleConns(2)
 
-	// DB setup for debugging
-	db.LogMode(true)
-	db.Debug()
+	// Every write to Products goes through the triggers of the full-text index, which need FTS5
+	if dialect == DialectSQLite && db.HasTable("ProductSearch") && !hasFTS5(db) {
+		db.Close()
+		return nil, errors.New("storage error: the database has a full-text search index but the binary was built " +
+			"without FTS5, build it with -tags sqlite_fts5")
+	}
+
+	// Statements carry stored values, API key hashes among them, so they are only logged when debugging
+	db.LogMode(logSQL)
 
-	return db
+	return db, nil
 }
 
-// Run a DB connection test
-func TestDB() *gorm.DB {
-	db, err := gorm.Open("sqlite3", "./data/test/products_test.db")
-	if err != nil {
-		fmt.Println("Storage Error: ", err)
+// sqliteOptions adds the SQLite driver options the repository relies on, unless the data source name sets them
+// Foreign keys are enforced, transactions take the write lock when they begin rather than failing
+// when a read turns into a write, and a connection waits for the lock for up to five seconds
+func sqliteOptions(dsn string) string {
+	options := [][]string{
+		{"_foreign_keys=1", "_foreign_keys", "_fk"},
+		{"_txlock=immediate", "_txlock"},
+		{"_busy_timeout=5000", "_busy_timeout", "_timeout"},
 	}
-	db.DB().SetMaxIdleConns(3)
-	db.LogMode(false)
-	db.Debug()
-	return db
+
+	for _, option := range options {
+		set := false
+		for _, name := range option[1:] {
+			set = set || strings.Contains(dsn, "?"+name+"=") || strings.Contains(dsn, "&"+name+"=")
+		}
+		if set {
+			continue
+		}
+
+		if strings.Contains(dsn, "?") {
+			dsn += "&" + option[0]
+		} else {
+			dsn += "?" + option[0]
+		}
+	}
+
+	return dsn
 }
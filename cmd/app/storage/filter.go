@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"../model"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Filter translation
+// Turns the conditions of a filter into SQL predicates for the GORM backend
+// and evaluates them directly for the in-memory backend
+
+// SQL comparison operators of the filter operators
+var sqlOps = map[string]string{
+	model.OpEq:  "=",
+	model.OpNe:  "<>",
+	model.OpGt:  ">",
+	model.OpGte: ">=",
+	model.OpLt:  "<",
+	model.OpLte: "<=",
+}
+
+// filter adds a predicate for every condition to the query on the given table
+func (r *GormRepository) filter(tx *gorm.DB, table string, f model.Filter) *gorm.DB {
+	for _, c := range f {
+		if c.Field == model.FieldHasOptions {
+			exists := "EXISTS (SELECT 1 FROM " + r.quote("ProductOptions") +
+				" WHERE " + r.column("ProductOptions", "ProductId") + " = " + r.column(table, "Id") +
+				" AND " + r.column("ProductOptions", "DeletedAt") + " IS NULL)"
+			if v, _ := c.Value.(bool); !v {
+				exists = "NOT " + exists
+			}
+			tx = tx.Where(exists)
+			continue
+		}
+
+		if c.Field == model.FieldInStock || c.Field == model.FieldLowStock {
+			available := r.column("Stock", "OnHand") + " - " + r.column("Stock", "Reserved")
+			level := available + " > 0"
+			if c.Field == model.FieldLowStock {
+				level = available + " <= " + r.column("Stock", "LowStockThreshold")
+			}
+			exists := "EXISTS (SELECT 1 FROM " + r.quote("Stock") +
+				" WHERE " + r.column("Stock", "ProductId") + " = " + r.column(table, "Id") + " AND " + level +
+				" AND " + r.liveStock("Stock") + ")"
+			if v, _ := c.Value.(bool); !v {
+				exists = "NOT " + exists
+			}
+			tx = tx.Where(exists)
+			continue
+		}
+
+		col := r.column(table, c.Field)
+		switch c.Op {
+		case model.OpPrefix:
+			tx = tx.Where("LOWER("+col+") LIKE ? ESCAPE '\\'", escapeLike(strings.ToLower(c.Value.(string)))+"%")
+		case model.OpContains:
+			tx = tx.Where("LOWER("+col+") LIKE ? ESCAPE '\\'", "%"+escapeLike(strings.ToLower(c.Value.(string)))+"%")
+		default:
+			tx = tx.Where(col+" "+sqlOps[c.Op]+" ?", c.Value)
+		}
+	}
+
+	return tx
+}
+
+// matchFilter reports whether every condition holds for the values returned by field
+func matchFilter(f model.Filter, field func(name string) interface{}) bool {
+	for _, c := range f {
+		if !matchCondition(field(c.Field), c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchCondition compares a value against the condition
+func matchCondition(v interface{}, c model.Condition) bool {
+	if b, ok := v.(bool); ok {
+		want, _ := c.Value.(bool)
+		return b == want
+	}
+
+	switch c.Op {
+	case model.OpPrefix:
+		s, _ := v.(string)
+		want, _ := c.Value.(string)
+		return strings.HasPrefix(strings.ToLower(s), strings.ToLower(want))
+	case model.OpContains:
+		s, _ := v.(string)
+		want, _ := c.Value.(string)
+		return strings.Contains(strings.ToLower(s), strings.ToLower(want))
+	}
+
+	cmp := compareValues(v, c.Value)
+	switch c.Op {
+	case model.OpEq:
+		return cmp == 0
+	case model.OpNe:
+		return cmp != 0
+	case model.OpGt:
+		return cmp > 0
+	case model.OpGte:
+		return cmp >= 0
+	case model.OpLt:
+		return cmp < 0
+	case model.OpLte:
+		return cmp <= 0
+	}
+
+	return false
+}
@@ -0,0 +1,418 @@
+package storage
+
+import (
+	"../model"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// GORM backed implementation of the repository
+// All SQL needed to persist products and their options is built in here
+// Identifiers are quoted through the dialect of the DB so the same queries
+// run against SQLite and Postgres, whose identifiers are case sensitive
+
+// GormRepository field holder
+type GormRepository struct {
+	db *gorm.DB
+
+	// Whether full-text searches run against an index, SQLite builds without FTS5 have none
+	fullText bool
+
+	// Queues up the stock transactions on SQLite
+	writes sync.Mutex
+}
+
+// Constructor returning a repository which runs its queries against the injected DB
+func NewGormRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{
+		db:       db,
+		fullText: db.Dialect().GetName() != DialectSQLite || (hasFTS5(db) && db.HasTable("ProductSearch")),
+	}
+}
+
+func (r *GormRepository) ListProducts(q model.ProductQuery) ([]model.Product, int, error) {
+	var products []model.Product
+	var total int
+
+	tx := r.db.Model(&model.Product{}).Select(r.quote("Products") + ".*")
+	if q.Name != "" {
+		tx = tx.Where(r.column("Products", "Name")+" = ?", q.Name)
+	}
+	if len(q.Statuses) > 0 {
+		tx = tx.Where(r.column("Products", "Status")+" IN (?)", q.Statuses)
+	}
+	tx = r.filter(tx, "Products", q.Filter)
+	if q.Search != nil {
+		// Relevance is only known to the search, so it orders the rows itself
+		tx = r.search(tx, q.Search, q.Sort.Field == model.SortRelevance)
+	}
+
+	// Counting ignores the order of the query
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := r.paginate(tx, "Products", q.Sort, q.Page).Find(&products).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return products, total, r.loadPrices(products)
+}
+
+func (r *GormRepository) GetProduct(id string) (*model.Product, error) {
+	var product model.Product
+
+	err := r.db.Where(r.quote("Id")+" = ?", id).Find(&product).Error
+
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	products := []model.Product{product}
+	if err = r.loadPrices(products); err != nil {
+		return nil, err
+	}
+
+	return &products[0], nil
+}
+
+func (r *GormRepository) CreateProduct(product *model.Product) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		product.Version = model.FirstVersion
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+
+		return r.savePrices(tx, product.ID, product.Prices)
+	})
+}
+
+func (r *GormRepository) ReplaceProduct(product *model.Product) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		byID := r.quote("Id") + " = ?"
+
+		// Claim the next version first, so the update only goes ahead on the expected one
+		res := r.versioned(tx.Model(&model.Product{}).Where(byID, product.ID), product.Version).
+			UpdateColumn("Version", r.nextVersion())
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return r.missed(tx, &model.Product{}, byID, product.ID)
+		}
+
+		// A map writes the zero values too
+		err := tx.Model(&model.Product{}).Where(byID, product.ID).Updates(map[string]interface{}{
+			"Name":          product.Name,
+			"Description":   product.Description,
+			"Price":         product.Price,
+			"DeliveryPrice": product.DeliveryPrice,
+			"Team":          product.Team,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if err = r.savePrices(tx, product.ID, product.Prices); err != nil {
+			return err
+		}
+
+		return r.currentVersion(tx, &model.Product{}, &product.Version, byID, product.ID)
+	})
+}
+
+func (r *GormRepository) DeleteProduct(id string, version int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		byID := r.quote("Id") + " = ?"
+		now := trashTime()
+		res := r.versioned(tx.Model(&model.Product{}).Where(byID, id), version).UpdateColumn("DeletedAt", now)
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return r.missed(tx, &model.Product{}, byID, id)
+		}
+
+		// Its options go to the trash at the same time, so they are restored with it
+		return tx.Model(&model.ProductOption{}).Where(r.quote("ProductId")+" = ?", id).UpdateColumn("DeletedAt", now).Error
+	})
+}
+
+func (r *GormRepository) SetProductStatus(id string, from string, to string) error {
+	res := r.db.Model(&model.Product{}).
+		Where(r.quote("Id")+" = ? AND "+r.quote("Status")+" = ?", id, from).
+		UpdateColumns(map[string]interface{}{"Status": to, "Version": r.nextVersion()})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// versioned narrows a write down to the expected version, any version when it is 0
+func (r *GormRepository) versioned(tx *gorm.DB, version int) *gorm.DB {
+	if version == 0 {
+		return tx
+	}
+
+	return tx.Where(r.quote("Version")+" = ?", version)
+}
+
+// nextVersion is the expression bumping the version of the rows written
+func (r *GormRepository) nextVersion() interface{} {
+	return gorm.Expr(r.quote("Version") + " + 1")
+}
+
+// missed tells why a versioned write touched no row, ErrNotFound when the row is
+// not there and ErrVersionMismatch when it moved on to another version
+func (r *GormRepository) missed(tx *gorm.DB, table interface{}, where string, args ...interface{}) error {
+	var count int
+	if err := tx.Model(table).Where(where, args...).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return ErrVersionMismatch
+}
+
+// currentVersion reads the version of the row back after a write
+func (r *GormRepository) currentVersion(tx *gorm.DB, table interface{}, version *int, where string, args ...interface{}) error {
+	var versions []int
+	if err := tx.Model(table).Where(where, args...).Pluck(r.quote("Version"), &versions).Error; err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return ErrNotFound
+	}
+	*version = versions[0]
+
+	return nil
+}
+
+// productExists returns ErrNotFound unless the product is there and not in the trash
+func (r *GormRepository) productExists(tx *gorm.DB, id string) error {
+	var count int
+	if err := tx.Model(&model.Product{}).Where(r.quote("Id")+" = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// loadPrices attaches the explicit prices to the products, ordered by currency
+func (r *GormRepository) loadPrices(products []model.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(products))
+	ids := make([]string, 0, len(products))
+	for i, p := range products {
+		index[p.ID] = i
+		ids = append(ids, p.ID)
+	}
+
+	var prices []model.ProductPrice
+	err := r.db.Where(r.quote("ProductId")+" IN (?)", ids).Order(r.quote("Currency")).Find(&prices).Error
+	if err != nil {
+		return err
+	}
+
+	for _, price := range prices {
+		i := index[price.ProductID]
+		products[i].Prices = append(products[i].Prices, price)
+	}
+
+	return nil
+}
+
+// savePrices replaces the explicit prices of a product within the transaction
+func (r *GormRepository) savePrices(tx *gorm.DB, productID string, prices []model.ProductPrice) error {
+	if err := tx.Where(r.quote("ProductId")+" = ?", productID).Delete(&model.ProductPrice{}).Error; err != nil {
+		return err
+	}
+
+	for _, price := range prices {
+		price.ProductID = productID
+		if err := tx.Create(&price).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *GormRepository) ListOptions(productID string, q model.OptionQuery) ([]model.ProductOption, int, error) {
+	var productOptions []model.ProductOption
+	var total int
+
+	tx := r.db.Model(&model.ProductOption{}).
+		Where(r.quote("ProductId")+" = ?", productID)
+	tx = r.filter(tx, "ProductOptions", q.Filter)
+
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := r.paginate(tx, "ProductOptions", q.Sort, q.Page).Find(&productOptions).Error
+
+	return productOptions, total, err
+}
+
+func (r *GormRepository) GetOption(productID string, optionID string) (*model.ProductOption, error) {
+	var productOption model.ProductOption
+
+	err := r.db.Where(r.quote("ProductId")+" = ? AND "+r.quote("Id")+" = ?", productID, optionID).
+		Find(&productOption).Error
+
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &productOption, nil
+}
+
+func (r *GormRepository) CreateOption(option *model.ProductOption) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := r.productExists(tx, option.ProductID); err != nil {
+			return err
+		}
+
+		option.Version = model.FirstVersion
+		return tx.Create(option).Error
+	})
+}
+
+func (r *GormRepository) CreateOptions(productID string, options []model.ProductOption) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := r.productExists(tx, productID); err != nil {
+			return err
+		}
+
+		for i := range options {
+			options[i].ProductID = productID
+			options[i].Version = model.FirstVersion
+			if err := tx.Create(&options[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *GormRepository) ReplaceOption(productID string, optionID string, option *model.ProductOption) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		byID := r.quote("Id") + " = ? AND " + r.quote("ProductId") + " = ?"
+
+		// Claim the next version first, so the update only goes ahead on the expected one
+		res := r.versioned(tx.Model(&model.ProductOption{}).Where(byID, optionID, productID), option.Version).
+			UpdateColumn("Version", r.nextVersion())
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return r.missed(tx, &model.ProductOption{}, byID, optionID, productID)
+		}
+
+		// A map writes the zero values too
+		err := tx.Model(&model.ProductOption{}).Where(byID, optionID, productID).Updates(map[string]interface{}{
+			"Name":                    option.Name,
+			"Description":             option.Description,
+			"Group":                   option.Group,
+			"PriceMode":               option.PriceMode,
+			"PriceAdjustment":         option.PriceAdjustment,
+			"DeliveryPriceMode":       option.DeliveryPriceMode,
+			"DeliveryPriceAdjustment": option.DeliveryPriceAdjustment,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return r.currentVersion(tx, &model.ProductOption{}, &option.Version, byID, optionID, productID)
+	})
+}
+
+func (r *GormRepository) DeleteOption(productID string, optionID string, version int) error {
+	byID := r.quote("Id") + " = ? AND " + r.quote("ProductId") + " = ?"
+	res := r.versioned(r.db.Model(&model.ProductOption{}).Where(byID, optionID, productID), version).
+		UpdateColumn("DeletedAt", trashTime())
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return r.missed(r.db, &model.ProductOption{}, byID, optionID, productID)
+	}
+
+	return nil
+}
+
+// paginate orders the query and narrows it down to the requested page
+// A cursor continues right after the row it marks, otherwise the offset is skipped
+// Relevance ordering is applied by the search, only the Id breaks its ties here
+func (r *GormRepository) paginate(tx *gorm.DB, table string, sort model.Sort, page model.Page) *gorm.DB {
+	id := r.column(table, "Id")
+	dir, cmp := "ASC", ">"
+	if sort.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if c := page.Cursor; c != nil && sort.Field != model.SortRelevance {
+		if sort.Field == "" {
+			tx = tx.Where(id+" "+cmp+" ?", c.ID)
+		} else {
+			col := r.column(table, sort.Field)
+			tx = tx.Where("("+col+" "+cmp+" ? OR ("+col+" = ? AND "+id+" "+cmp+" ?))", c.Value, c.Value, c.ID)
+		}
+	} else if page.Offset > 0 {
+		tx = tx.Offset(page.Offset)
+	}
+
+	if sort.Field != "" && sort.Field != model.SortRelevance {
+		tx = tx.Order(r.column(table, sort.Field) + " " + dir)
+	}
+	tx = tx.Order(id + " " + dir)
+
+	if page.Limit > 0 {
+		tx = tx.Limit(page.Limit)
+	}
+
+	return tx
+}
+
+// quote wraps a column name in the identifier quotes of the dialect
+func (r *GormRepository) quote(column string) string {
+	return r.db.Dialect().Quote(column)
+}
+
+// column returns the quoted column qualified by its table, safe to use in joins
+func (r *GormRepository) column(table string, column string) string {
+	return r.quote(table) + "." + r.quote(column)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSQLiteConformance runs the conformance suite against a scratch SQLite file
+func TestSQLiteConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "product-check-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	runConformance(t, migratedRepository(t, filepath.Join(dir, "products.db")))
+}
+
+// TestPostgresConformance runs the conformance suite against a local Postgres server
+// It is skipped when neither a server nor the binaries can be found
+func TestPostgresConformance(t *testing.T) {
+	pg, err := startLocalPostgres()
+	if errors.Is(err, errPostgresUnavailable) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := pg.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	runConformance(t, migratedRepository(t, pg.DSN()))
+}
+
+// migratedRepository opens the data source and brings its schema up to date
+func migratedRepository(t *testing.T, dsn string) *GormRepository {
+	db, err := New(dsn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err = NewMigrator(db).Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewGormRepository(db)
+}
+
+// TestMigratingKeysToRoles checks keys created before roles become editors when they may write
+// and viewers otherwise
+func TestMigratingKeysToRoles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "product-check-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := New(filepath.Join(dir, "products.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrator := NewMigrator(db)
+	if _, err = migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Down(2); err != nil {
+		t.Fatal(err)
+	}
+
+	scopes := map[string]string{"r": "products:read", "rw": "products:read products:write", "w": "products:write", "x": "products:writer"}
+	for id, s := range scopes {
+		err = db.Exec(`INSERT INTO "ApiKeys" ("Id", "Name", "Hash", "Scopes", "CreatedAt") VALUES (?, ?, '', ?, CURRENT_TIMESTAMP)`, id, id, s).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"r": "viewer", "rw": "editor", "w": "editor", "x": "viewer"}
+	for id, role := range expected {
+		var got string
+		if err = db.Raw(`SELECT "Role" FROM "ApiKeys" WHERE "Id" = ?`, id).Row().Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != role {
+			t.Fatalf("key with scopes %q migrated as %s, expected %s", scopes[id], got, role)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package storage
+
+import (
+	"../model"
+	"sort"
+	"sync"
+)
+
+// In-memory implementation of the repository
+// Keeps products, options and variants in maps guarded by a read/write lock so it is
+// safe for concurrent use, needs no files on disk and mirrors the behaviour
+// of the GORM backend, including trashing the options of a deleted product
+
+// MemoryRepository field holder
+type MemoryRepository struct {
+	mu sync.RWMutex
+
+	// Products keyed by ID, with the order of insertion kept for stable listing
+	products     map[string]model.Product
+	productOrder []string
+
+	// Options keyed by ID, with the order of insertion kept for stable listing
+	options     map[string]model.ProductOption
+	optionOrder []string
+
+	// Deleted products and options keyed by ID, out of reach of every other read
+	deletedProducts map[string]model.Product
+	deletedOptions  map[string]model.ProductOption
+
+	// Variants keyed by ID, listed by SKU
+	variants map[string]model.ProductVariant
+
+	// Stock levels keyed by product and option, reservations keyed by ID and
+	// the ledger in the order of the movements
+	stock        map[string]model.Stock
+	reservations map[string]model.StockReservation
+	movements    []model.StockMovement
+
+	// API keys keyed by ID
+	apiKeys map[string]model.APIKey
+}
+
+// Constructor returning an empty in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		products:        make(map[string]model.Product),
+		options:         make(map[string]model.ProductOption),
+		deletedProducts: make(map[string]model.Product),
+		deletedOptions:  make(map[string]model.ProductOption),
+		variants:        make(map[string]model.ProductVariant),
+		stock:           make(map[string]model.Stock),
+		reservations:    make(map[string]model.StockReservation),
+		apiKeys:         make(map[string]model.APIKey),
+	}
+}
+
+func (r *MemoryRepository) ListProducts(q model.ProductQuery) ([]model.Product, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []model.Product
+	var rows []listRow
+	for _, id := range r.productOrder {
+		p := r.products[id]
+		if q.Name != "" && p.Name != q.Name {
+			continue
+		}
+		if len(q.Statuses) > 0 && !containsString(q.Statuses, p.Status) {
+			continue
+		}
+		if !matchFilter(q.Filter, func(field string) interface{} { return r.productField(p, field) }) {
+			continue
+		}
+
+		row := listRow{value: p.SortValue(q.Sort.Field), id: p.ID, index: len(matches)}
+		if q.Search != nil {
+			ok, score := matchProduct(p, q.Search)
+			if !ok {
+				continue
+			}
+			if q.Sort.Field == model.SortRelevance {
+				row.value = score
+			}
+		}
+
+		rows = append(rows, row)
+		matches = append(matches, p)
+	}
+
+	products := make([]model.Product, 0, len(matches))
+	for _, i := range pageIndexes(rows, q.Sort, q.Page) {
+		p := matches[i]
+		p.Prices = copyPrices(p.ID, p.Prices)
+		products = append(products, p)
+	}
+
+	return products, len(matches), nil
+}
+
+func (r *MemoryRepository) GetProduct(id string) (*model.Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	product, ok := r.products[id]
+	if !ok {
+		return nil, nil
+	}
+	product.Prices = copyPrices(product.ID, product.Prices)
+
+	return &product, nil
+}
+
+func (r *MemoryRepository) CreateProduct(product *model.Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.products[product.ID]; ok {
+		return ErrDuplicate
+	}
+	if _, ok := r.deletedProducts[product.ID]; ok {
+		return ErrDuplicate
+	}
+
+	product.Version = model.FirstVersion
+	stored := *product
+	stored.ProductOption = nil
+	stored.Currency = ""
+	stored.Prices = copyPrices(product.ID, product.Prices)
+	r.products[product.ID] = stored
+	r.productOrder = append(r.productOrder, product.ID)
+
+	return nil
+}
+
+func (r *MemoryRepository) ReplaceProduct(product *model.Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.products[product.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if product.Version != 0 && product.Version != stored.Version {
+		return ErrVersionMismatch
+	}
+
+	stored.Name = product.Name
+	stored.Description = product.Description
+	stored.Price = product.Price
+	stored.DeliveryPrice = product.DeliveryPrice
+	stored.Team = product.Team
+	stored.Prices = copyPrices(product.ID, product.Prices)
+	stored.Version++
+	product.Version = stored.Version
+	r.products[product.ID] = stored
+
+	return nil
+}
+
+func (r *MemoryRepository) SetProductStatus(id string, from string, to string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[id]
+	if !ok || product.Status != from {
+		return ErrNotFound
+	}
+
+	product.Status = to
+	product.Version++
+	r.products[id] = product
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteProduct(id string, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if version != 0 && version != product.Version {
+		return ErrVersionMismatch
+	}
+
+	now := trashTime()
+	product.DeletedAt = &now
+	r.deletedProducts[id] = product
+	delete(r.products, id)
+	r.productOrder = removeID(r.productOrder, id)
+
+	// Its options go to the trash at the same time, so they are restored with it
+	for optionID, option := range r.options {
+		if option.ProductID == id {
+			option.DeletedAt = &now
+			r.deletedOptions[optionID] = option
+			delete(r.options, optionID)
+			r.optionOrder = removeID(r.optionOrder, optionID)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ListOptions(productID string, q model.OptionQuery) ([]model.ProductOption, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []model.ProductOption
+	var rows []listRow
+	for _, id := range r.optionOrder {
+		if o := r.options[id]; o.ProductID == productID && matchFilter(q.Filter, func(field string) interface{} { return optionField(o, field) }) {
+			rows = append(rows, listRow{value: o.SortValue(q.Sort.Field), id: o.ID, index: len(matches)})
+			matches = append(matches, o)
+		}
+	}
+
+	productOptions := make([]model.ProductOption, 0, len(matches))
+	for _, i := range pageIndexes(rows, q.Sort, q.Page) {
+		productOptions = append(productOptions, matches[i])
+	}
+
+	return productOptions, len(matches), nil
+}
+
+func (r *MemoryRepository) GetOption(productID string, optionID string) (*model.ProductOption, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	option, ok := r.options[optionID]
+	if !ok || option.ProductID != productID {
+		return nil, nil
+	}
+
+	return &option, nil
+}
+
+func (r *MemoryRepository) CreateOption(option *model.ProductOption) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.products[option.ProductID]; !ok {
+		return ErrNotFound
+	}
+	if r.optionTaken(option.ID) {
+		return ErrDuplicate
+	}
+
+	option.Version = model.FirstVersion
+	r.options[option.ID] = *option
+	r.optionOrder = append(r.optionOrder, option.ID)
+
+	return nil
+}
+
+func (r *MemoryRepository) CreateOptions(productID string, options []model.ProductOption) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.products[productID]; !ok {
+		return ErrNotFound
+	}
+
+	// Check the whole batch before storing any of it
+	batch := make(map[string]bool, len(options))
+	for _, o := range options {
+		if r.optionTaken(o.ID) || batch[o.ID] {
+			return ErrDuplicate
+		}
+		batch[o.ID] = true
+	}
+
+	for i := range options {
+		options[i].ProductID = productID
+		options[i].Version = model.FirstVersion
+		r.options[options[i].ID] = options[i]
+		r.optionOrder = append(r.optionOrder, options[i].ID)
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ReplaceOption(productID string, optionID string, option *model.ProductOption) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.options[optionID]
+	if !ok || stored.ProductID != productID {
+		return ErrNotFound
+	}
+	if option.Version != 0 && option.Version != stored.Version {
+		return ErrVersionMismatch
+	}
+
+	stored.Name = option.Name
+	stored.Description = option.Description
+	stored.Group = option.Group
+	stored.PriceMode = option.PriceMode
+	stored.PriceAdjustment = option.PriceAdjustment
+	stored.DeliveryPriceMode = option.DeliveryPriceMode
+	stored.DeliveryPriceAdjustment = option.DeliveryPriceAdjustment
+	stored.Version++
+	option.Version = stored.Version
+	r.options[optionID] = stored
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteOption(productID string, optionID string, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	option, ok := r.options[optionID]
+	if !ok || option.ProductID != productID {
+		return ErrNotFound
+	}
+	if version != 0 && version != option.Version {
+		return ErrVersionMismatch
+	}
+
+	now := trashTime()
+	option.DeletedAt = &now
+	r.deletedOptions[optionID] = option
+	delete(r.options, optionID)
+	r.optionOrder = removeID(r.optionOrder, optionID)
+
+	return nil
+}
+
+// optionTaken reports whether an option, deleted or not, already uses the ID
+// Needs the read lock to be held
+func (r *MemoryRepository) optionTaken(id string) bool {
+	_, live := r.options[id]
+	_, deleted := r.deletedOptions[id]
+
+	return live || deleted
+}
+
+// productField returns the value of a filterable product field
+// Needs the read lock to be held to look at the options
+func (r *MemoryRepository) productField(p model.Product, field string) interface{} {
+	switch field {
+	case "Description":
+		return p.Description
+	case model.FieldInStock, model.FieldLowStock:
+		for _, s := range r.stock {
+			if s.ProductID != p.ID || !r.liveStock(s) {
+				continue
+			}
+			s.Compute()
+			if (field == model.FieldInStock && s.Available > 0) || (field == model.FieldLowStock && s.Low) {
+				return true
+			}
+		}
+		return false
+	case model.FieldHasOptions:
+		for _, o := range r.options {
+			if o.ProductID == p.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	return p.SortValue(field)
+}
+
+// optionField returns the value of a filterable option field
+func optionField(o model.ProductOption, field string) interface{} {
+	if field == "Description" {
+		return o.Description
+	}
+
+	return o.SortValue(field)
+}
+
+// copyPrices returns a copy of the prices ordered by currency, tied to the product
+// so the caller and the repository never share a slice
+func copyPrices(productID string, prices []model.ProductPrice) []model.ProductPrice {
+	if len(prices) == 0 {
+		return nil
+	}
+
+	copied := append([]model.ProductPrice(nil), prices...)
+	for i := range copied {
+		copied[i].ProductID = productID
+	}
+	sort.Slice(copied, func(i, j int) bool { return copied[i].Currency < copied[j].Currency })
+
+	return copied
+}
+
+// removeID drops the given ID from an ordered list of IDs
+func removeID(ids []string, id string) []string {
+	for i, v := range ids {
+		if v == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+
+	return ids
+}
+
+// containsString reports whether the list holds the value
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"../model"
+	"../utils"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestMemoryConformance runs the conformance suite against the in-memory backend
+// Several runs share the repository at once, so with -race they also check its locking
+func TestMemoryConformance(t *testing.T) {
+	repo := NewMemoryRepository()
+	for i := 0; i < 4; i++ {
+		t.Run(fmt.Sprintf("run %d", i), func(t *testing.T) {
+			t.Parallel()
+			runConformance(t, repo)
+		})
+	}
+}
+
+// TestMemoryConcurrentCreateDelete creates and deletes products and their options from
+// many goroutines while others list them, leaving nothing behind
+func TestMemoryConcurrentCreateDelete(t *testing.T) {
+	repo := NewMemoryRepository()
+	name := "race-" + utils.GenerateUUID()[:8]
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 32; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- createDelete(repo, name)
+		}()
+		go func() {
+			defer wg.Done()
+			_, _, err := repo.ListProducts(model.ProductQuery{Name: name, Filter: model.Filter{{Field: model.FieldHasOptions, Op: model.OpEq, Value: true}}})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if products, total, err := repo.ListProducts(model.ProductQuery{Name: name}); err != nil || total != 0 {
+		t.Fatalf("list products after deleting them all: %v total %d: %v", products, total, err)
+	}
+}
+
+// createDelete creates a product with an option and deletes it again
+func createDelete(repo Repository, name string) error {
+	product := model.Product{ID: utils.GenerateUUID(), Name: name, Price: 1000}
+	if err := repo.CreateProduct(&product); err != nil {
+		return fmt.Errorf("create product: %v", err)
+	}
+	if err := repo.CreateOption(&model.ProductOption{ID: utils.GenerateUUID(), ProductID: product.ID, Name: "x"}); err != nil {
+		return fmt.Errorf("create option: %v", err)
+	}
+	if err := repo.DeleteProduct(product.ID, 0); err != nil {
+		return fmt.Errorf("delete product: %v", err)
+	}
+
+	return repo.PurgeProduct(product.ID)
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Schema migration kit
+// Migrations are compiled into the binary, applied in version order and
+// recorded in the schema_version table so every environment can be brought
+// to, or rolled back from, the same schema
+
+// Name of the table keeping track of the applied migrations
+const schemaVersionTable = "schema_version"
+
+// Migration describes one versioned step of the schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+
+	// Statements replacing Up and Down for a specific dialect
+	Dialects map[string]Statements
+
+	// When set and reporting false the migration is recorded as skipped without running its statements,
+	// for optional features the database does not support, and it is pending again once When reports true
+	When func(db *gorm.DB) bool
+}
+
+// Statements holds the dialect specific statements of a migration
+type Statements struct {
+	Up   []string
+	Down []string
+}
+
+// skipped reports whether the migration is left out on the DB
+func (mg Migration) skipped(db *gorm.DB) bool {
+	return mg.When != nil && !mg.When(db)
+}
+
+// statements returns the up and down statements to run for the dialect
+func (mg Migration) statements(dialect string) Statements {
+	if st, ok := mg.Dialects[dialect]; ok {
+		return st
+	}
+
+	return Statements{Up: mg.Up, Down: mg.Down}
+}
+
+// Applied version row as stored in the schema_version table
+type schemaVersion struct {
+	Version   int       `gorm:"column:version;primary_key"`
+	Name      string    `gorm:"column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+	Skipped   bool      `gorm:"column:skipped;not null;default:false"`
+}
+
+func (schemaVersion) TableName() string {
+	return schemaVersionTable
+}
+
+// Migrator field holder
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// Constructor returning a migrator for the registered migrations of the service
+func NewMigrator(db *gorm.DB) *Migrator {
+	ms := make([]Migration, len(migrations))
+	copy(ms, migrations)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+
+	return &Migrator{
+		db:         db,
+		migrations: ms,
+	}
+}
+
+// Current returns the highest applied version, 0 when the schema is empty
+func (m *Migrator) Current() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	current := 0
+	for v := range applied {
+		if v > current {
+			current = v
+		}
+	}
+
+	return current, nil
+}
+
+// Pending returns the migrations which have not been applied yet, along with the skipped ones
+// the DB supports by now, such as the full-text index once the binary is built with FTS5
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, mg := range m.migrations {
+		row, ok := applied[mg.Version]
+		if !ok || (row.Skipped && !mg.skipped(m.db)) {
+			pending = append(pending, mg)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies every pending migration in order, each inside its own transaction
+// A migration skipped before is applied late, its record updated
+func (m *Migrator) Up() ([]Migration, error) {
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mg := range pending {
+		statements, skipped := mg.statements(m.dialect()).Up, mg.skipped(m.db)
+		if skipped {
+			statements = nil
+		}
+		err = m.run(statements, func(tx *gorm.DB) error {
+			return tx.Save(&schemaVersion{Version: mg.Version, Name: mg.Name, AppliedAt: time.Now().UTC(), Skipped: skipped}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s: %v", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg)
+	}
+
+	return done, nil
+}
+
+// Down rolls back the given number of the most recently applied migrations
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mg := m.migrations[i]
+		if _, ok := applied[mg.Version]; !ok {
+			continue
+		}
+
+		err = m.run(mg.statements(m.dialect()).Down, func(tx *gorm.DB) error {
+			return tx.Delete(&schemaVersion{Version: mg.Version}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback %d %s: %v", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg)
+	}
+
+	return done, nil
+}
+
+// dialect names the SQL dialect of the DB
+func (m *Migrator) dialect() string {
+	return m.db.Dialect().GetName()
+}
+
+// run executes the statements and the bookkeeping in a single transaction
+func (m *Migrator) run(statements []string, record func(tx *gorm.DB) error) error {
+	tx := m.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	for _, stmt := range statements {
+		if err := tx.Exec(stmt).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// applied ensures the schema_version table exists and returns the applied versions with their records
+func (m *Migrator) applied() (map[int]schemaVersion, error) {
+	if err := m.db.AutoMigrate(&schemaVersion{}).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []schemaVersion
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]schemaVersion, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+
+	return applied, nil
+}
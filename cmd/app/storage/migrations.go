@@ -0,0 +1,289 @@
+package storage
+
+// Registry of the schema migrations of the service
+// Append new migrations with the next version number, never edit one which
+// has already been released
+// Identifiers are double quoted so the statements stay portable across dialects
+
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_products",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS "Products" (
+				"Id" varchar(36) PRIMARY KEY,
+				"Name" varchar(17) NOT NULL,
+				"Description" varchar(35) DEFAULT NULL,
+				"Price" decimal(6,2) DEFAULT NULL,
+				"DeliveryPrice" decimal(6,2) DEFAULT NULL
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS "Products"`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_product_options",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS "ProductOptions" (
+				"Id" varchar(36) PRIMARY KEY,
+				"ProductId" varchar(36),
+				"Name" varchar(17) NOT NULL,
+				"Description" varchar(35) DEFAULT NULL,
+				FOREIGN KEY("ProductId") REFERENCES "Products"("Id") ON DELETE CASCADE
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS "ProductOptions"`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_product_search",
+		// SQLite builds without the sqlite_fts5 tag go without the index and search without it
+		When: fullTextAvailable,
+		Dialects: map[string]Statements{
+			// FTS5 index over the Products table kept in sync by triggers
+			DialectSQLite: {
+				Up: []string{
+					`CREATE VIRTUAL TABLE "ProductSearch" USING fts5(
+						"Name", "Description", content='Products', content_rowid='rowid'
+					)`,
+					`CREATE TRIGGER "ProductSearchInsert" AFTER INSERT ON "Products" BEGIN
+						INSERT INTO "ProductSearch"(rowid, "Name", "Description") VALUES (new.rowid, new."Name", new."Description");
+					END`,
+					`CREATE TRIGGER "ProductSearchDelete" AFTER DELETE ON "Products" BEGIN
+						INSERT INTO "ProductSearch"("ProductSearch", rowid, "Name", "Description") VALUES ('delete', old.rowid, old."Name", old."Description");
+					END`,
+					`CREATE TRIGGER "ProductSearchUpdate" AFTER UPDATE ON "Products" BEGIN
+						INSERT INTO "ProductSearch"("ProductSearch", rowid, "Name", "Description") VALUES ('delete', old.rowid, old."Name", old."Description");
+						INSERT INTO "ProductSearch"(rowid, "Name", "Description") VALUES (new.rowid, new."Name", new."Description");
+					END`,
+					`INSERT INTO "ProductSearch"("ProductSearch") VALUES ('rebuild')`,
+				},
+				Down: []string{
+					`DROP TRIGGER IF EXISTS "ProductSearchUpdate"`,
+					`DROP TRIGGER IF EXISTS "ProductSearchDelete"`,
+					`DROP TRIGGER IF EXISTS "ProductSearchInsert"`,
+					`DROP TABLE IF EXISTS "ProductSearch"`,
+				},
+			},
+			// Expression index matching the document searched by the repository
+			DialectPostgres: {
+				Up: []string{
+					`CREATE INDEX "ProductSearch" ON "Products" USING GIN (to_tsvector('simple', ` + postgresSearchDocument + `))`,
+				},
+				Down: []string{
+					`DROP INDEX IF EXISTS "ProductSearch"`,
+				},
+			},
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_product_prices",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS "ProductPrices" (
+				"ProductId" varchar(36) NOT NULL,
+				"Currency" varchar(3) NOT NULL,
+				"Price" decimal(6,2) DEFAULT NULL,
+				"DeliveryPrice" decimal(6,2) DEFAULT NULL,
+				PRIMARY KEY("ProductId", "Currency"),
+				FOREIGN KEY("ProductId") REFERENCES "Products"("Id") ON DELETE CASCADE
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS "ProductPrices"`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_option_price_adjustments",
+		Up: []string{
+			`ALTER TABLE "ProductOptions" ADD COLUMN "PriceMode" varchar(8) DEFAULT NULL`,
+			`ALTER TABLE "ProductOptions" ADD COLUMN "PriceAdjustment" decimal(6,2) DEFAULT NULL`,
+			`ALTER TABLE "ProductOptions" ADD COLUMN "DeliveryPriceMode" varchar(8) DEFAULT NULL`,
+			`ALTER TABLE "ProductOptions" ADD COLUMN "DeliveryPriceAdjustment" decimal(6,2) DEFAULT NULL`,
+		},
+		Down: []string{
+			`ALTER TABLE "ProductOptions" DROP COLUMN "DeliveryPriceAdjustment"`,
+			`ALTER TABLE "ProductOptions" DROP COLUMN "DeliveryPriceMode"`,
+			`ALTER TABLE "ProductOptions" DROP COLUMN "PriceAdjustment"`,
+			`ALTER TABLE "ProductOptions" DROP COLUMN "PriceMode"`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_product_variants",
+		Up: []string{
+			`ALTER TABLE "ProductOptions" ADD COLUMN "Group" varchar(17) DEFAULT NULL`,
+			`CREATE TABLE IF NOT EXISTS "ProductVariants" (
+				"Id" varchar(36) PRIMARY KEY,
+				"ProductId" varchar(36) NOT NULL,
+				"Sku" varchar(64) NOT NULL UNIQUE,
+				"OptionIds" text NOT NULL,
+				"Price" decimal(6,2) DEFAULT NULL,
+				"Enabled" boolean NOT NULL DEFAULT TRUE,
+				UNIQUE("ProductId", "OptionIds"),
+				FOREIGN KEY("ProductId") REFERENCES "Products"("Id") ON DELETE CASCADE
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS "ProductVariants"`,
+			`ALTER TABLE "ProductOptions" DROP COLUMN "Group"`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_stock",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS "Stock" (
+				"ProductId" varchar(36) NOT NULL,
+				"OptionId" varchar(36) NOT NULL DEFAULT '',
+				"OnHand" integer NOT NULL DEFAULT 0,
+				"Reserved" integer NOT NULL DEFAULT 0,
+				"LowStockThreshold" integer NOT NULL DEFAULT 0,
+				PRIMARY KEY("ProductId", "OptionId"),
+				CHECK("Reserved" >= 0 AND "OnHand" >= "Reserved"),
+				FOREIGN KEY("ProductId") REFERENCES "Products"("Id") ON DELETE CASCADE
+			)`,
+			`CREATE TABLE IF NOT EXISTS "StockReservations" (
+				"Id" varchar(36) PRIMARY KEY,
+				"ProductId" varchar(36) NOT NULL,
+				"OptionId" varchar(36) NOT NULL DEFAULT '',
+				"Quantity" integer NOT NULL,
+				"Status" varchar(9) NOT NULL,
+				"CreatedAt" timestamp NOT NULL,
+				"UpdatedAt" timestamp NOT NULL,
+				FOREIGN KEY("ProductId") REFERENCES "Products"("Id") ON DELETE CASCADE
+			)`,
+			// The ledger outlives the products it mentions, so it has no foreign key
+			`CREATE TABLE IF NOT EXISTS "StockMovements" (
+				"Id" varchar(36) PRIMARY KEY,
+				"ProductId" varchar(36) NOT NULL,
+				"OptionId" varchar(36) NOT NULL DEFAULT '',
+				"Kind" varchar(8) NOT NULL,
+				"OnHandChange" integer NOT NULL,
+				"ReservedChange" integer NOT NULL,
+				"OnHand" integer NOT NULL,
+				"Reserved" integer NOT NULL,
+				"ReservationId" varchar(36) NOT NULL DEFAULT '',
+				"CreatedAt" timestamp NOT NULL
+			)`,
+			`CREATE INDEX "StockMovementsProduct" ON "StockMovements"("ProductId", "CreatedAt")`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS "StockMovementsProduct"`,
+			`DROP TABLE IF EXISTS "StockMovements"`,
+			`DROP TABLE IF EXISTS "StockReservations"`,
+			`DROP TABLE IF EXISTS "Stock"`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_product_status",
+		// Products which were listed before keep being listed
+		Up: []string{
+			`ALTER TABLE "Products" ADD COLUMN "Status" varchar(9) NOT NULL DEFAULT 'published'`,
+			`CREATE INDEX "ProductsStatus" ON "Products"("Status")`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS "ProductsStatus"`,
+			`ALTER TABLE "Products" DROP COLUMN "Status"`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_soft_delete",
+		Up: []string{
+			`ALTER TABLE "Products" ADD COLUMN "DeletedAt" timestamp DEFAULT NULL`,
+			`ALTER TABLE "ProductOptions" ADD COLUMN "DeletedAt" timestamp DEFAULT NULL`,
+			`CREATE INDEX "ProductsDeletedAt" ON "Products"("DeletedAt")`,
+			`CREATE INDEX "ProductOptionsDeletedAt" ON "ProductOptions"("DeletedAt")`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS "ProductOptionsDeletedAt"`,
+			`DROP INDEX IF EXISTS "ProductsDeletedAt"`,
+			`ALTER TABLE "ProductOptions" DROP COLUMN "DeletedAt"`,
+			`ALTER TABLE "Products" DROP COLUMN "DeletedAt"`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_versions",
+		Up: []string{
+			`ALTER TABLE "Products" ADD COLUMN "Version" integer NOT NULL DEFAULT 1`,
+			`ALTER TABLE "ProductOptions" ADD COLUMN "Version" integer NOT NULL DEFAULT 1`,
+		},
+		Down: []string{
+			`ALTER TABLE "ProductOptions" DROP COLUMN "Version"`,
+			`ALTER TABLE "Products" DROP COLUMN "Version"`,
+		},
+	},
+	{
+		Version: 11,
+		Name:    "create_api_keys",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS "ApiKeys" (
+				"Id" varchar(36) PRIMARY KEY,
+				"Name" varchar(64) NOT NULL,
+				"Hash" varchar(64) NOT NULL,
+				"Scopes" varchar(255) NOT NULL DEFAULT '',
+				"Disabled" boolean NOT NULL DEFAULT false,
+				"CreatedAt" timestamp NOT NULL,
+				"LastUsedAt" timestamp DEFAULT NULL
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS "ApiKeys"`,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add_ownership",
+		Up: []string{
+			`ALTER TABLE "Products" ADD COLUMN "Team" varchar(64) NOT NULL DEFAULT ''`,
+			`ALTER TABLE "Products" ADD COLUMN "Owner" varchar(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE "ApiKeys" ADD COLUMN "Role" varchar(16) NOT NULL DEFAULT 'viewer'`,
+			// Keys issued before roles keep writing, those with the write scope become editors
+			`UPDATE "ApiKeys" SET "Role" = 'editor' WHERE ' ' || "Scopes" || ' ' LIKE '% products:write %'`,
+			`ALTER TABLE "ApiKeys" ADD COLUMN "Team" varchar(64) NOT NULL DEFAULT ''`,
+		},
+		Down: []string{
+			`ALTER TABLE "ApiKeys" DROP COLUMN "Team"`,
+			`ALTER TABLE "ApiKeys" DROP COLUMN "Role"`,
+			`ALTER TABLE "Products" DROP COLUMN "Owner"`,
+			`ALTER TABLE "Products" DROP COLUMN "Team"`,
+		},
+	},
+	{
+		Version: 13,
+		Name:    "widen_amounts",
+		Dialects: map[string]Statements{
+			// SQLite does not enforce the precision of a decimal column, so there is nothing to change
+			DialectSQLite: {},
+			// Room for three decimal places and amounts up to 999999999.999
+			DialectPostgres: {
+				Up: []string{
+					`ALTER TABLE "Products" ALTER COLUMN "Price" TYPE decimal(12,3)`,
+					`ALTER TABLE "Products" ALTER COLUMN "DeliveryPrice" TYPE decimal(12,3)`,
+					`ALTER TABLE "ProductPrices" ALTER COLUMN "Price" TYPE decimal(12,3)`,
+					`ALTER TABLE "ProductPrices" ALTER COLUMN "DeliveryPrice" TYPE decimal(12,3)`,
+					`ALTER TABLE "ProductOptions" ALTER COLUMN "PriceAdjustment" TYPE decimal(12,3)`,
+					`ALTER TABLE "ProductOptions" ALTER COLUMN "DeliveryPriceAdjustment" TYPE decimal(12,3)`,
+					`ALTER TABLE "ProductVariants" ALTER COLUMN "Price" TYPE decimal(12,3)`,
+				},
+				Down: []string{
+					`ALTER TABLE "ProductVariants" ALTER COLUMN "Price" TYPE decimal(6,2)`,
+					`ALTER TABLE "ProductOptions" ALTER COLUMN "DeliveryPriceAdjustment" TYPE decimal(6,2)`,
+					`ALTER TABLE "ProductOptions" ALTER COLUMN "PriceAdjustment" TYPE decimal(6,2)`,
+					`ALTER TABLE "ProductPrices" ALTER COLUMN "DeliveryPrice" TYPE decimal(6,2)`,
+					`ALTER TABLE "ProductPrices" ALTER COLUMN "Price" TYPE decimal(6,2)`,
+					`ALTER TABLE "Products" ALTER COLUMN "DeliveryPrice" TYPE decimal(6,2)`,
+					`ALTER TABLE "Products" ALTER COLUMN "Price" TYPE decimal(6,2)`,
+				},
+			},
+		},
+	},
+}
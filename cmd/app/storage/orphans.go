@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"../model"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Orphan storage
+// Rows are orphaned when the product or option they belong to is gone, which
+// databases written before the foreign keys were enforced can still hold
+// Products and options in the trash are not gone, so nothing of theirs is touched
+
+// orphanRule tells the orphaned rows of a table apart
+type orphanRule struct {
+	table string
+	where string
+}
+
+// orphanRules lists the tables which can hold orphans, options first so the
+// rows of orphaned options are found along with them
+func (r *GormRepository) orphanRules() []orphanRule {
+	product := func(table string) string {
+		return "NOT EXISTS (SELECT 1 FROM " + r.quote("Products") + " WHERE " +
+			r.column("Products", "Id") + " = " + r.column(table, "ProductId") + ")"
+	}
+	option := func(table string) string {
+		return product(table) + " OR (" + r.column(table, "OptionId") + " <> '' AND NOT EXISTS (SELECT 1 FROM " +
+			r.quote("ProductOptions") + " WHERE " + r.column("ProductOptions", "Id") + " = " + r.column(table, "OptionId") +
+			" AND " + r.column("ProductOptions", "ProductId") + " = " + r.column(table, "ProductId") + "))"
+	}
+
+	return []orphanRule{
+		{table: "ProductOptions", where: product("ProductOptions")},
+		{table: "ProductPrices", where: product("ProductPrices")},
+		{table: "ProductVariants", where: product("ProductVariants")},
+		{table: "Stock", where: option("Stock")},
+		{table: "StockReservations", where: option("StockReservations")},
+	}
+}
+
+func (r *GormRepository) Orphans() ([]model.Orphans, error) {
+	var orphans []model.Orphans
+
+	for _, rule := range r.orphanRules() {
+		var count int
+		if err := r.db.Table(rule.table).Where(rule.where).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			orphans = append(orphans, model.Orphans{Table: rule.table, Rows: count})
+		}
+	}
+
+	return orphans, nil
+}
+
+func (r *GormRepository) DeleteOrphans() ([]model.Orphans, error) {
+	var removed []model.Orphans
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, rule := range r.orphanRules() {
+			res := tx.Exec("DELETE FROM " + r.quote(rule.table) + " WHERE " + rule.where)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				removed = append(removed, model.Orphans{Table: rule.table, Rows: int(res.RowsAffected)})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
+
+func (r *MemoryRepository) Orphans() ([]model.Orphans, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.orphans(false), nil
+}
+
+func (r *MemoryRepository) DeleteOrphans() ([]model.Orphans, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.orphans(true), nil
+}
+
+// orphans counts the orphaned entries of every map, removing them when asked to
+// Prices live inside their product so they cannot be orphaned
+// Needs the read lock to be held to count and the lock to remove
+func (r *MemoryRepository) orphans(remove bool) []model.Orphans {
+	var orphans []model.Orphans
+	tally := func(table string, count int) {
+		if count > 0 {
+			orphans = append(orphans, model.Orphans{Table: table, Rows: count})
+		}
+	}
+
+	hasProduct := func(id string) bool {
+		_, live := r.products[id]
+		_, deleted := r.deletedProducts[id]
+		return live || deleted
+	}
+	hasOption := func(productID string, optionID string) bool {
+		if optionID == "" {
+			return true
+		}
+		o, ok := r.options[optionID]
+		if !ok {
+			o, ok = r.deletedOptions[optionID]
+		}
+		return ok && o.ProductID == productID
+	}
+
+	count := 0
+	for id, o := range r.options {
+		if !hasProduct(o.ProductID) {
+			count++
+			if remove {
+				delete(r.options, id)
+				r.optionOrder = removeID(r.optionOrder, id)
+			}
+		}
+	}
+	for id, o := range r.deletedOptions {
+		if !hasProduct(o.ProductID) {
+			count++
+			if remove {
+				delete(r.deletedOptions, id)
+			}
+		}
+	}
+	tally("ProductOptions", count)
+
+	count = 0
+	for id, v := range r.variants {
+		if !hasProduct(v.ProductID) {
+			count++
+			if remove {
+				delete(r.variants, id)
+			}
+		}
+	}
+	tally("ProductVariants", count)
+
+	count = 0
+	for key, s := range r.stock {
+		if !hasProduct(s.ProductID) || !hasOption(s.ProductID, s.OptionID) {
+			count++
+			if remove {
+				delete(r.stock, key)
+			}
+		}
+	}
+	tally("Stock", count)
+
+	count = 0
+	for id, s := range r.reservations {
+		if !hasProduct(s.ProductID) || !hasOption(s.ProductID, s.OptionID) {
+			count++
+			if remove {
+				delete(r.reservations, id)
+			}
+		}
+	}
+	tally("StockReservations", count)
+
+	return orphans
+}
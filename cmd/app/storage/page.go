@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"../model"
+	"sort"
+	"strings"
+)
+
+// Paging helpers for backends which hold their rows in memory
+// Rows are ordered the same way the SQL backends order them, by the sort
+// field first and by Id to break ties, so cursors behave identically
+
+// listRow is the sortable projection of one row
+type listRow struct {
+	value interface{}
+	id    string
+	index int
+}
+
+// pageIndexes orders the rows and returns the original indexes of the requested page
+func pageIndexes(rows []listRow, s model.Sort, page model.Page) []int {
+	sort.SliceStable(rows, func(i, j int) bool {
+		c := compareRows(rows[i], rows[j])
+		if s.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	start := page.Offset
+	if c := page.Cursor; c != nil {
+		after := listRow{value: c.Value, id: c.ID}
+		start = len(rows)
+		for i, row := range rows {
+			cmp := compareRows(row, after)
+			if (s.Desc && cmp < 0) || (!s.Desc && cmp > 0) {
+				start = i
+				break
+			}
+		}
+	}
+	if start > len(rows) {
+		start = len(rows)
+	}
+
+	end := len(rows)
+	if page.Limit > 0 && start+page.Limit < end {
+		end = start + page.Limit
+	}
+
+	indexes := make([]int, 0, end-start)
+	for _, row := range rows[start:end] {
+		indexes = append(indexes, row.index)
+	}
+
+	return indexes
+}
+
+// compareRows orders by value, then by Id
+func compareRows(a, b listRow) int {
+	if c := compareValues(a.value, b.value); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.id, b.id)
+}
+
+// compareValues orders two values of the same kind, mismatching kinds compare equal
+func compareValues(a, b interface{}) int {
+	switch av := a.(type) {
+	case string:
+		bv, _ := b.(string)
+		return strings.Compare(av, bv)
+	case float64:
+		bv, _ := b.(float64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	}
+
+	return 0
+}
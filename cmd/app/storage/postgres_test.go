@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Local Postgres harness
+// Starts a throwaway Postgres cluster from the binaries installed on the
+// machine so the Postgres backend can be exercised without docker
+// Set PRODUCT_TEST_POSTGRES_DSN to use an already running server instead
+
+// testPostgresEnv is the environment variable pointing the harness at an existing server
+const testPostgresEnv = "PRODUCT_TEST_POSTGRES_DSN"
+
+// errPostgresUnavailable is returned when no server is configured and no binaries can be found
+var errPostgresUnavailable = errors.New("postgres is not available on this machine")
+
+// localPostgres is a running server along with the files of a temporary cluster
+type localPostgres struct {
+	dsn    string
+	dir    string
+	pgCtl  string
+	data   string
+	static bool
+}
+
+// startLocalPostgres brings up a temporary cluster, or returns the configured server
+func startLocalPostgres() (*localPostgres, error) {
+	if dsn := os.Getenv(testPostgresEnv); dsn != "" {
+		return &localPostgres{dsn: dsn, static: true}, nil
+	}
+
+	initdb, pgCtl := findPostgresBinary("initdb"), findPostgresBinary("pg_ctl")
+	if initdb == "" || pgCtl == "" {
+		return nil, errPostgresUnavailable
+	}
+
+	// Postgres refuses to run as root
+	if os.Geteuid() == 0 {
+		return nil, fmt.Errorf("%w: cannot start a cluster as root", errPostgresUnavailable)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "product-pg-")
+	if err != nil {
+		return nil, err
+	}
+	data := filepath.Join(dir, "data")
+
+	out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("initdb: %v: %s", err, out)
+	}
+
+	opts := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off", port, dir)
+	out, err = exec.Command(pgCtl, "-D", data, "-o", opts, "-l", filepath.Join(dir, "postgres.log"), "-w", "start").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("pg_ctl start: %v: %s", err, out)
+	}
+
+	return &localPostgres{
+		dsn:   fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port),
+		dir:   dir,
+		pgCtl: pgCtl,
+		data:  data,
+	}, nil
+}
+
+// DSN returns the connection string of the server
+func (p *localPostgres) DSN() string {
+	return p.dsn
+}
+
+// Stop shuts the temporary cluster down and removes its files
+func (p *localPostgres) Stop() error {
+	if p.static {
+		return nil
+	}
+
+	out, err := exec.Command(p.pgCtl, "-D", p.data, "-m", "fast", "-w", "stop").CombinedOutput()
+	os.RemoveAll(p.dir)
+	if err != nil {
+		return fmt.Errorf("pg_ctl stop: %v: %s", err, out)
+	}
+
+	return nil
+}
+
+// findPostgresBinary looks the binary up on the PATH and in the usual distribution locations
+func findPostgresBinary(name string) string {
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+
+	matches, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql", "*", "bin", name))
+	if len(matches) > 0 {
+		return matches[len(matches)-1]
+	}
+
+	return ""
+}
+
+// freePort asks the kernel for a port nobody is listening on
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
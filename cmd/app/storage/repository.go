@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"../model"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// This is the storage abstraction section
+// Every backend the service can persist to implements the repository
+// interfaces below, which keeps the controller free of any query building
+// and allows backends to be swapped without touching the business logic
+
+// ErrNotFound is returned by a repository when a write targets a record which does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrDuplicate is returned by a repository when a create uses an ID which is already taken
+var ErrDuplicate = errors.New("record already exists")
+
+// ErrVersionMismatch is returned when a write expects a version which is no longer the current one
+var ErrVersionMismatch = errors.New("the resource was changed in the meantime")
+
+// ErrInsufficientStock is returned when a stock change would take more units than are available
+var ErrInsufficientStock = errors.New("not enough stock available")
+
+// ErrReservationClosed is returned when a reservation has already been released or committed
+var ErrReservationClosed = errors.New("reservation is no longer open")
+
+// Names of the backends which can be selected at startup
+// The SQL backend works out its dialect from the data source name
+const (
+	BackendSQL    = "sql"
+	BackendMemory = "memory"
+)
+
+// ProductRepository holds the persistence operations for products
+// Writes taking a version only apply to that version of the product, any version when it
+// is 0, and return ErrVersionMismatch otherwise
+type ProductRepository interface {
+	// ListProducts returns the requested page along with the total number of matching products
+	ListProducts(q model.ProductQuery) ([]model.Product, int, error)
+	// GetProduct returns nil without an error when no product matches
+	GetProduct(id string) (*model.Product, error)
+	// CreateProduct stores the product at its first version
+	CreateProduct(product *model.Product) error
+	// ReplaceProduct writes every editable field and the explicit prices of the product, zero values included,
+	// expecting the version held by the product and leaving the new one in its place
+	ReplaceProduct(product *model.Product) error
+	// SetProductStatus moves a product on and bumps its version, returning ErrNotFound unless it is in the from status
+	SetProductStatus(id string, from string, to string) error
+	// DeleteProduct moves the product to the trash along with its options
+	DeleteProduct(id string, version int) error
+}
+
+// ProductOptionRepository holds the persistence operations for the options of a product
+// Versions work the same way as they do for products
+type ProductOptionRepository interface {
+	// ListOptions returns the requested page along with the total number of options of the product
+	ListOptions(productID string, q model.OptionQuery) ([]model.ProductOption, int, error)
+	// GetOption returns nil without an error when no option matches
+	GetOption(productID string, optionID string) (*model.ProductOption, error)
+	// CreateOption stores the option at its first version, returning ErrNotFound when the product does not exist
+	CreateOption(option *model.ProductOption) error
+	// CreateOptions stores all of the options or none of them
+	CreateOptions(productID string, options []model.ProductOption) error
+	// ReplaceOption writes every editable field of the option, zero values included,
+	// expecting the version held by the option and leaving the new one in its place
+	ReplaceOption(productID string, optionID string, option *model.ProductOption) error
+	// DeleteOption moves the option to the trash
+	DeleteOption(productID string, optionID string, version int) error
+}
+
+// ProductVariantRepository holds the persistence operations for the variants of a product
+// Writes return ErrDuplicate when a SKU is already taken by another variant
+type ProductVariantRepository interface {
+	// ListVariants returns the variants of the product ordered by SKU
+	ListVariants(productID string) ([]model.ProductVariant, error)
+	// GetVariant returns nil without an error when no variant matches
+	GetVariant(productID string, variantID string) (*model.ProductVariant, error)
+	// CreateVariants stores all of the variants or none of them
+	CreateVariants(variants []model.ProductVariant) error
+	// GenerateVariants disables the variants with the given IDs and stores the new ones in one go
+	GenerateVariants(productID string, disable []string, variants []model.ProductVariant) error
+	// UpdateVariant replaces the SKU, price and enabled flag of a variant
+	UpdateVariant(productID string, variantID string, variant *model.ProductVariant) error
+	DeleteVariant(productID string, variantID string) error
+}
+
+// StockRepository holds the stock levels, reservations and ledger of products
+// Every change to a level is atomic and recorded in the ledger along with it
+type StockRepository interface {
+	// ListStock returns the stock levels of the product, the product level first
+	ListStock(productID string) ([]model.Stock, error)
+	// SetStock sets the units on hand and the low stock threshold, creating the level when needed
+	// Returns ErrInsufficientStock when fewer units than are reserved would be left on hand
+	SetStock(stock *model.Stock) error
+	// Reserve holds units of an existing level, returning ErrInsufficientStock when too few are available
+	Reserve(reservation *model.StockReservation) error
+	// GetReservation returns nil without an error when no reservation matches
+	GetReservation(productID string, reservationID string) (*model.StockReservation, error)
+	// CloseReservation releases or commits an open reservation, returning ErrReservationClosed otherwise
+	CloseReservation(productID string, reservationID string, status string) (*model.StockReservation, error)
+	// ListMovements returns the requested page of the ledger of the product, oldest first, with its total size
+	ListMovements(productID string, page model.Page) ([]model.StockMovement, int, error)
+}
+
+// TrashRepository holds the deleted products and options, which no other read returns,
+// until they are restored or purged
+// Each returns ErrNotFound when the product or option is not in the trash
+type TrashRepository interface {
+	// ListDeletedProducts returns the requested page of deleted products, most recently deleted first, with their total number
+	ListDeletedProducts(page model.Page) ([]model.Product, int, error)
+	// RestoreProduct brings a product back along with the options deleted with it
+	RestoreProduct(id string) error
+	// ListDeletedOptions returns the options deleted on their own from a product, most recently deleted first
+	ListDeletedOptions(productID string) ([]model.ProductOption, error)
+	RestoreOption(productID string, optionID string) error
+	// PurgeProduct removes a deleted product for good, along with everything belonging to it
+	PurgeProduct(id string) error
+	// Purge removes the products and options deleted before the given time for good
+	Purge(before time.Time) (model.PurgeResult, error)
+}
+
+// OrphanRepository finds and removes the rows pointing at a product or option which no longer exists
+// Deleted products and options still count as existing until they are purged
+type OrphanRepository interface {
+	// Orphans counts the orphaned rows of every table which has any
+	Orphans() ([]model.Orphans, error)
+	// DeleteOrphans removes the orphaned rows of every table at once and reports what was removed
+	DeleteOrphans() ([]model.Orphans, error)
+}
+
+// APIKeyRepository holds the API keys of service-to-service clients
+// Writes return ErrNotFound when the key does not exist
+type APIKeyRepository interface {
+	// ListAPIKeys returns every key, oldest first
+	ListAPIKeys() ([]model.APIKey, error)
+	// GetAPIKey returns nil without an error when no key matches
+	GetAPIKey(id string) (*model.APIKey, error)
+	CreateAPIKey(key *model.APIKey) error
+	// SetAPIKeyDisabled turns a key off or back on
+	SetAPIKeyDisabled(id string, disabled bool) error
+	// TouchAPIKey records when the key was last used
+	TouchAPIKey(id string, at time.Time) error
+	// DeleteAPIKey revokes the key for good
+	DeleteAPIKey(id string) error
+}
+
+// Repository is the complete storage surface needed by the product controller
+type Repository interface {
+	ProductRepository
+	ProductOptionRepository
+	ProductVariantRepository
+	StockRepository
+	TrashRepository
+	OrphanRepository
+	APIKeyRepository
+}
+
+// Open returns the repository for the named backend
+// When autoMigrate is set pending schema migrations are applied first, otherwise a database
+// with pending migrations is refused
+func Open(backend string, dsn string, autoMigrate bool, logSQL bool) (Repository, error) {
+	switch backend {
+	case BackendSQL:
+		db, err := New(dsn, logSQL)
+		if err != nil {
+			return nil, err
+		}
+		if autoMigrate {
+			if _, err := NewMigrator(db).Up(); err != nil {
+				return nil, err
+			}
+		}
+
+		// Queries need the latest schema, so an outdated one is refused rather than failing request by request
+		pending, err := NewMigrator(db).Pending()
+		if err != nil {
+			return nil, err
+		}
+		if len(pending) > 0 {
+			db.Close()
+			return nil, fmt.Errorf("the database schema is %d migrations behind, next being %d %s: "+
+				"run the migrate up command or start with -migrate", len(pending), pending[0].Version, pending[0].Name)
+		}
+
+		return NewGormRepository(db), nil
+	case BackendMemory:
+		return NewMemoryRepository(), nil
+	}
+
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"../model"
+	"strings"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Product search
+// Exact, prefix and substring matching run as plain predicates, full-text
+// matching uses the FTS5 index on SQLite and a tsvector expression index on
+// Postgres, and is mirrored by a simple word matcher for the in-memory backend
+// SQLite builds without the sqlite_fts5 tag have no index and match every word
+// of the term as a substring instead, without relevance
+
+// postgresSearchDocument is the text indexed and searched by Postgres for full-text matching
+const postgresSearchDocument = `coalesce("Name", '') || ' ' || coalesce("Description", '')`
+
+// searchFields returns the fields to search, both name and description by default
+func searchFields(s *model.Search) []string {
+	if len(s.Fields) == 0 {
+		return []string{"Name", "Description"}
+	}
+
+	return s.Fields
+}
+
+// search narrows the product query down to the matches of the search
+// With relevance sorting the best matches are ordered first
+func (r *GormRepository) search(tx *gorm.DB, s *model.Search, relevance bool) *gorm.DB {
+	fields := searchFields(s)
+
+	if s.Mode == model.SearchFullText {
+		if r.db.Dialect().GetName() == DialectPostgres {
+			doc := "to_tsvector('simple', " + postgresDocument(fields) + ")"
+			tx = tx.Where(doc+" @@ plainto_tsquery('simple', ?)", s.Term)
+			if relevance {
+				tx = tx.Order(gorm.Expr("ts_rank("+doc+", plainto_tsquery('simple', ?)) DESC", s.Term))
+			}
+			return tx
+		}
+
+		if !r.fullText {
+			cond, args := r.wordsLike(fields, s.Term)
+			return tx.Where(cond, args...)
+		}
+
+		index := r.quote("ProductSearch")
+		tx = tx.Joins("JOIN "+index+" ON "+index+".rowid = "+r.quote("Products")+".rowid").
+			Where(index+" MATCH ?", ftsQuery(fields, s.Term))
+		if relevance {
+			tx = tx.Order(index + ".rank")
+		}
+		return tx
+	}
+
+	var conds []string
+	var args []interface{}
+	for _, f := range fields {
+		col := r.column("Products", f)
+		switch s.Mode {
+		case model.SearchExact:
+			conds = append(conds, col+" = ?")
+			args = append(args, s.Term)
+		case model.SearchPrefix:
+			conds = append(conds, "LOWER("+col+") LIKE ? ESCAPE '\\'")
+			args = append(args, escapeLike(strings.ToLower(s.Term))+"%")
+		default:
+			conds = append(conds, "LOWER("+col+") LIKE ? ESCAPE '\\'")
+			args = append(args, "%"+escapeLike(strings.ToLower(s.Term))+"%")
+		}
+	}
+
+	return tx.Where("("+strings.Join(conds, " OR ")+")", args...)
+}
+
+// postgresDocument joins the searched fields the same way the expression index does
+func postgresDocument(fields []string) string {
+	if len(fields) == 2 {
+		return postgresSearchDocument
+	}
+
+	return `coalesce("` + fields[0] + `", '')`
+}
+
+// ftsQuery builds an FTS5 query matching every word of the term in the given columns
+// Words are quoted so user input cannot inject FTS5 syntax
+func ftsQuery(fields []string, term string) string {
+	var phrases []string
+	for _, word := range words(term) {
+		phrases = append(phrases, `"`+strings.Replace(word, `"`, `""`, -1)+`"`)
+	}
+
+	return "{" + strings.Join(fields, " ") + "} : (" + strings.Join(phrases, " ") + ")"
+}
+
+// wordsLike builds the predicate matching every word of the term in one of the fields
+func (r *GormRepository) wordsLike(fields []string, term string) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, word := range words(term) {
+		var either []string
+		for _, f := range fields {
+			either = append(either, "LOWER("+r.column("Products", f)+") LIKE ? ESCAPE '\\'")
+			args = append(args, "%"+escapeLike(word)+"%")
+		}
+		conds = append(conds, "("+strings.Join(either, " OR ")+")")
+	}
+	if len(conds) == 0 {
+		return "1 = 1", nil
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// hasFTS5 reports whether the SQLite library was compiled with FTS5, which takes the sqlite_fts5 build tag
+func hasFTS5(db *gorm.DB) bool {
+	var used int
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Row().Scan(&used); err != nil {
+		return false
+	}
+
+	return used == 1
+}
+
+// fullTextAvailable reports whether the full-text index can be built, Postgres always can
+func fullTextAvailable(db *gorm.DB) bool {
+	return db.Dialect().GetName() != DialectSQLite || hasFTS5(db)
+}
+
+// escapeLike escapes the LIKE wildcards of a term
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+// words splits text into lower cased words of letters and digits
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchProduct reports whether the product matches the search and how relevant it is
+// Full-text relevance counts the occurrences of the term words, weighted by field length
+func matchProduct(p model.Product, s *model.Search) (bool, float64) {
+	var values []string
+	for _, f := range searchFields(s) {
+		if f == "Name" {
+			values = append(values, p.Name)
+		} else if f == "Description" {
+			values = append(values, p.Description)
+		}
+	}
+
+	switch s.Mode {
+	case model.SearchExact:
+		for _, v := range values {
+			if v == s.Term {
+				return true, 0
+			}
+		}
+	case model.SearchPrefix:
+		for _, v := range values {
+			if strings.HasPrefix(strings.ToLower(v), strings.ToLower(s.Term)) {
+				return true, 0
+			}
+		}
+	case model.SearchContains:
+		for _, v := range values {
+			if strings.Contains(strings.ToLower(v), strings.ToLower(s.Term)) {
+				return true, 0
+			}
+		}
+	case model.SearchFullText:
+		var doc []string
+		for _, v := range values {
+			doc = append(doc, words(v)...)
+		}
+
+		score := 0.0
+		for _, w := range words(s.Term) {
+			hits := 0
+			for _, d := range doc {
+				if d == w {
+					hits++
+				}
+			}
+			if hits == 0 {
+				return false, 0
+			}
+			score += float64(hits) / float64(len(doc))
+		}
+		return true, score
+	}
+
+	return false, 0
+}
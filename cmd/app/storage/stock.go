@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"../model"
+	"../utils"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Stock storage
+// Reservations take units through a single conditional update, setting the stock
+// works on the locked level, and the in-memory backend does both under its lock, so
+// concurrent requests can never oversell, and every change writes its ledger entry
+// in the same transaction
+
+// serialize runs fn in a transaction, one at a time when the DB is SQLite
+// which takes a single writer, so stock changes queue up instead of failing busy
+func (r *GormRepository) serialize(fn func(tx *gorm.DB) error) error {
+	if r.db.Dialect().GetName() == DialectSQLite {
+		r.writes.Lock()
+		defer r.writes.Unlock()
+	}
+
+	return r.db.Transaction(fn)
+}
+
+// forUpdate locks the rows the query reads until the transaction ends on Postgres
+// SQLite transactions take the write lock when they begin, which already keeps other writers out
+func (r *GormRepository) forUpdate(tx *gorm.DB) *gorm.DB {
+	if r.db.Dialect().GetName() == DialectPostgres {
+		return tx.Set("gorm:query_option", "FOR UPDATE")
+	}
+
+	return tx
+}
+
+// stockKey selects the stock level of a product or option
+func (r *GormRepository) stockKey(tx *gorm.DB, productID string, optionID string) *gorm.DB {
+	return tx.Where(r.quote("ProductId")+" = ? AND "+r.quote("OptionId")+" = ?", productID, optionID)
+}
+
+// liveStock limits the stock levels in the table to the product and its options outside the trash
+func (r *GormRepository) liveStock(table string) string {
+	option := r.column(table, "OptionId")
+	return "(" + option + " = '' OR " + option + " IN (SELECT " + r.quote("Id") + " FROM " + r.quote("ProductOptions") +
+		" WHERE " + r.quote("DeletedAt") + " IS NULL))"
+}
+
+func (r *GormRepository) ListStock(productID string) ([]model.Stock, error) {
+	var levels []model.Stock
+
+	err := r.db.Where(r.quote("ProductId")+" = ?", productID).
+		Where(r.liveStock("Stock")).
+		Order(r.quote("OptionId")).
+		Find(&levels).Error
+
+	for i := range levels {
+		levels[i].Compute()
+	}
+
+	return levels, err
+}
+
+func (r *GormRepository) SetStock(stock *model.Stock) error {
+	return r.serialize(func(tx *gorm.DB) error {
+		// Concurrent first calls both find no level, so it is inserted empty unless
+		// there already is one, and the adjustment below covers the whole quantity
+		err := tx.Exec("INSERT INTO "+r.quote("Stock")+" ("+r.quote("ProductId")+", "+r.quote("OptionId")+") VALUES (?, ?) ON CONFLICT DO NOTHING",
+			stock.ProductID, stock.OptionID).Error
+		if err != nil {
+			return err
+		}
+
+		// The level stays locked until the transaction ends, so reservations made meanwhile
+		// are not lost to the update
+		var current model.Stock
+		if err = r.stockKey(r.forUpdate(tx), stock.ProductID, stock.OptionID).Find(&current).Error; err != nil {
+			return err
+		}
+		if stock.OnHand < current.Reserved {
+			return ErrInsufficientStock
+		}
+
+		change := stock.OnHand - current.OnHand
+		stock.Reserved = current.Reserved
+		err = r.stockKey(tx.Model(&model.Stock{}), stock.ProductID, stock.OptionID).
+			Updates(map[string]interface{}{"OnHand": stock.OnHand, "LowStockThreshold": stock.LowStockThreshold}).Error
+		if err != nil {
+			return err
+		}
+		stock.Compute()
+
+		if change == 0 {
+			return nil
+		}
+		return tx.Create(movement(stock, model.MovementAdjust, change, 0, "")).Error
+	})
+}
+
+func (r *GormRepository) Reserve(reservation *model.StockReservation) error {
+	return r.serialize(func(tx *gorm.DB) error {
+		res := r.stockKey(tx.Model(&model.Stock{}), reservation.ProductID, reservation.OptionID).
+			Where(r.quote("OnHand")+" - "+r.quote("Reserved")+" >= ?", reservation.Quantity).
+			UpdateColumn("Reserved", gorm.Expr(r.quote("Reserved")+" + ?", reservation.Quantity))
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		var level model.Stock
+		if err := r.stockKey(tx, reservation.ProductID, reservation.OptionID).Find(&level).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if res.RowsAffected == 0 {
+			return ErrInsufficientStock
+		}
+
+		reservation.Status = model.ReservationOpen
+		reservation.CreatedAt = time.Now().UTC()
+		reservation.UpdatedAt = reservation.CreatedAt
+		if err := tx.Create(reservation).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(movement(&level, model.MovementReserve, 0, reservation.Quantity, reservation.ID)).Error
+	})
+}
+
+func (r *GormRepository) GetReservation(productID string, reservationID string) (*model.StockReservation, error) {
+	var reservation model.StockReservation
+
+	err := r.db.Where(r.quote("ProductId")+" = ? AND "+r.quote("Id")+" = ?", productID, reservationID).
+		Find(&reservation).Error
+
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+func (r *GormRepository) CloseReservation(productID string, reservationID string, status string) (*model.StockReservation, error) {
+	var reservation model.StockReservation
+
+	err := r.serialize(func(tx *gorm.DB) error {
+		err := tx.Where(r.quote("ProductId")+" = ? AND "+r.quote("Id")+" = ?", productID, reservationID).
+			Find(&reservation).Error
+		if err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		// Only one request can move the reservation out of the open status
+		now := time.Now().UTC()
+		res := tx.Model(&model.StockReservation{}).
+			Where(r.quote("Id")+" = ? AND "+r.quote("Status")+" = ?", reservationID, model.ReservationOpen).
+			Updates(map[string]interface{}{"Status": status, "UpdatedAt": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrReservationClosed
+		}
+		reservation.Status, reservation.UpdatedAt = status, now
+
+		onHand, kind := 0, model.MovementRelease
+		changes := map[string]interface{}{"Reserved": gorm.Expr(r.quote("Reserved")+" - ?", reservation.Quantity)}
+		if status == model.ReservationCommitted {
+			onHand, kind = -reservation.Quantity, model.MovementCommit
+			changes["OnHand"] = gorm.Expr(r.quote("OnHand")+" - ?", reservation.Quantity)
+		}
+		if err = r.stockKey(tx.Model(&model.Stock{}), productID, reservation.OptionID).Updates(changes).Error; err != nil {
+			return err
+		}
+
+		var level model.Stock
+		if err = r.stockKey(tx, productID, reservation.OptionID).Find(&level).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		return tx.Create(movement(&level, kind, onHand, -reservation.Quantity, reservation.ID)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+func (r *GormRepository) ListMovements(productID string, page model.Page) ([]model.StockMovement, int, error) {
+	var movements []model.StockMovement
+	var total int
+
+	tx := r.db.Model(&model.StockMovement{}).Where(r.quote("ProductId")+" = ?", productID)
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := tx.Order(r.quote("CreatedAt")).Order(r.quote("Id")).
+		Offset(page.Offset).Limit(page.Limit).
+		Find(&movements).Error
+
+	return movements, total, err
+}
+
+func (r *MemoryRepository) ListStock(productID string) ([]model.Stock, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	levels := []model.Stock{}
+	for _, s := range r.stock {
+		if s.ProductID == productID && r.liveStock(s) {
+			s.Compute()
+			levels = append(levels, s)
+		}
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].OptionID < levels[j].OptionID })
+
+	return levels, nil
+}
+
+func (r *MemoryRepository) SetStock(stock *model.Stock) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := stockKey(stock.ProductID, stock.OptionID)
+	current, ok := r.stock[key]
+	if ok && stock.OnHand < current.Reserved {
+		return ErrInsufficientStock
+	}
+
+	stock.Reserved = current.Reserved
+	change := stock.OnHand - current.OnHand
+	r.stock[key] = *stock
+	stock.Compute()
+
+	if change != 0 {
+		r.movements = append(r.movements, *movement(stock, model.MovementAdjust, change, 0, ""))
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) Reserve(reservation *model.StockReservation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := stockKey(reservation.ProductID, reservation.OptionID)
+	level, ok := r.stock[key]
+	if !ok {
+		return ErrNotFound
+	}
+	if level.OnHand-level.Reserved < reservation.Quantity {
+		return ErrInsufficientStock
+	}
+
+	level.Reserved += reservation.Quantity
+	r.stock[key] = level
+
+	reservation.Status = model.ReservationOpen
+	reservation.CreatedAt = time.Now().UTC()
+	reservation.UpdatedAt = reservation.CreatedAt
+	r.reservations[reservation.ID] = *reservation
+	r.movements = append(r.movements, *movement(&level, model.MovementReserve, 0, reservation.Quantity, reservation.ID))
+
+	return nil
+}
+
+func (r *MemoryRepository) GetReservation(productID string, reservationID string) (*model.StockReservation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reservation, ok := r.reservations[reservationID]
+	if !ok || reservation.ProductID != productID {
+		return nil, nil
+	}
+
+	return &reservation, nil
+}
+
+func (r *MemoryRepository) CloseReservation(productID string, reservationID string, status string) (*model.StockReservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation, ok := r.reservations[reservationID]
+	if !ok || reservation.ProductID != productID {
+		return nil, ErrNotFound
+	}
+	if reservation.Status != model.ReservationOpen {
+		return nil, ErrReservationClosed
+	}
+
+	key := stockKey(productID, reservation.OptionID)
+	level, ok := r.stock[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	level.Reserved -= reservation.Quantity
+	onHand, kind := 0, model.MovementRelease
+	if status == model.ReservationCommitted {
+		onHand, kind = -reservation.Quantity, model.MovementCommit
+		level.OnHand -= reservation.Quantity
+	}
+	r.stock[key] = level
+
+	reservation.Status = status
+	reservation.UpdatedAt = time.Now().UTC()
+	r.reservations[reservationID] = reservation
+	r.movements = append(r.movements, *movement(&level, kind, onHand, -reservation.Quantity, reservation.ID))
+
+	return &reservation, nil
+}
+
+func (r *MemoryRepository) ListMovements(productID string, page model.Page) ([]model.StockMovement, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []model.StockMovement
+	for _, m := range r.movements {
+		if m.ProductID == productID {
+			matches = append(matches, m)
+		}
+	}
+
+	movements := []model.StockMovement{}
+	for i := page.Offset; i < len(matches) && (page.Limit <= 0 || len(movements) < page.Limit); i++ {
+		movements = append(movements, matches[i])
+	}
+
+	return movements, len(matches), nil
+}
+
+// liveStock reports whether the level belongs to the product or one of its options outside the trash
+// Needs the read lock to be held
+func (r *MemoryRepository) liveStock(level model.Stock) bool {
+	_, ok := r.options[level.OptionID]
+	return level.OptionID == "" || ok
+}
+
+// stockKey identifies the stock level of a product or option
+func stockKey(productID string, optionID string) string {
+	return productID + "/" + optionID
+}
+
+// movement builds the ledger entry of a change which left the level as given
+func movement(level *model.Stock, kind string, onHand int, reserved int, reservationID string) *model.StockMovement {
+	return &model.StockMovement{
+		ID:             utils.GenerateUUID(),
+		ProductID:      level.ProductID,
+		OptionID:       level.OptionID,
+		Kind:           kind,
+		OnHandChange:   onHand,
+		ReservedChange: reserved,
+		OnHand:         level.OnHand,
+		Reserved:       level.Reserved,
+		ReservationID:  reservationID,
+		CreatedAt:      time.Now().UTC(),
+	}
+}
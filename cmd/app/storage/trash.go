@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"../model"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Trash storage
+// Deleting a product or option only stamps its DeletedAt, which GORM leaves out
+// of every query unless it is unscoped, and the in-memory backend moves it to
+// maps of its own
+// Prices, variants and stock stay with a deleted product until it is purged
+
+// trashTime returns the deletion time, cut to the precision every backend stores
+func trashTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (r *GormRepository) ListDeletedProducts(page model.Page) ([]model.Product, int, error) {
+	var products []model.Product
+	var total int
+
+	tx := r.db.Unscoped().Model(&model.Product{}).Where(r.quote("DeletedAt") + " IS NOT NULL")
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := tx.Order(r.quote("DeletedAt") + " DESC").Order(r.quote("Id")).
+		Offset(page.Offset).Limit(page.Limit).
+		Find(&products).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return products, total, r.loadPrices(products)
+}
+
+func (r *GormRepository) RestoreProduct(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var product model.Product
+		err := tx.Unscoped().Where(r.quote("Id")+" = ? AND "+r.quote("DeletedAt")+" IS NOT NULL", id).
+			Find(&product).Error
+		if err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		err = tx.Unscoped().Model(&model.Product{}).Where(r.quote("Id")+" = ?", id).
+			UpdateColumn("DeletedAt", gorm.Expr("NULL")).Error
+		if err != nil {
+			return err
+		}
+
+		// Options deleted on their own before stay in the trash
+		return tx.Unscoped().Model(&model.ProductOption{}).
+			Where(r.quote("ProductId")+" = ? AND "+r.quote("DeletedAt")+" = ?", id, *product.DeletedAt).
+			UpdateColumn("DeletedAt", gorm.Expr("NULL")).Error
+	})
+}
+
+func (r *GormRepository) ListDeletedOptions(productID string) ([]model.ProductOption, error) {
+	var options []model.ProductOption
+
+	err := r.db.Unscoped().
+		Where(r.quote("ProductId")+" = ? AND "+r.quote("DeletedAt")+" IS NOT NULL", productID).
+		Order(r.quote("DeletedAt") + " DESC").Order(r.quote("Id")).
+		Find(&options).Error
+
+	return options, err
+}
+
+func (r *GormRepository) RestoreOption(productID string, optionID string) error {
+	res := r.db.Unscoped().Model(&model.ProductOption{}).
+		Where(r.quote("Id")+" = ? AND "+r.quote("ProductId")+" = ? AND "+r.quote("DeletedAt")+" IS NOT NULL", optionID, productID).
+		UpdateColumn("DeletedAt", gorm.Expr("NULL"))
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *GormRepository) PurgeProduct(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var count int
+		err := tx.Unscoped().Model(&model.Product{}).
+			Where(r.quote("Id")+" = ? AND "+r.quote("DeletedAt")+" IS NOT NULL", id).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+
+		return r.purgeProducts(tx, []string{id})
+	})
+}
+
+func (r *GormRepository) Purge(before time.Time) (model.PurgeResult, error) {
+	result := model.PurgeResult{Before: before}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var productIDs, optionIDs []string
+
+		err := tx.Unscoped().Model(&model.Product{}).
+			Where(r.quote("DeletedAt")+" < ?", before).
+			Pluck(r.quote("Id"), &productIDs).Error
+		if err != nil {
+			return err
+		}
+		if len(productIDs) > 0 {
+			if err = r.purgeProducts(tx, productIDs); err != nil {
+				return err
+			}
+		}
+
+		err = tx.Unscoped().Model(&model.ProductOption{}).
+			Where(r.quote("DeletedAt")+" < ?", before).
+			Pluck(r.quote("Id"), &optionIDs).Error
+		if err != nil {
+			return err
+		}
+		if len(optionIDs) > 0 {
+			if err = r.purgeOptions(tx, optionIDs); err != nil {
+				return err
+			}
+		}
+
+		result.Products, result.Options = len(productIDs), len(optionIDs)
+		return nil
+	})
+
+	return result, err
+}
+
+// purgeProducts removes the products for good along with everything belonging to them
+// The stock ledger is kept for reconciliation
+func (r *GormRepository) purgeProducts(tx *gorm.DB, ids []string) error {
+	owned := r.quote("ProductId") + " IN (?)"
+	for _, m := range []interface{}{&model.ProductPrice{}, &model.ProductVariant{}, &model.Stock{}, &model.StockReservation{}} {
+		if err := tx.Where(owned, ids).Delete(m).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Unscoped().Where(owned, ids).Delete(&model.ProductOption{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Unscoped().Where(r.quote("Id")+" IN (?)", ids).Delete(&model.Product{}).Error
+}
+
+// purgeOptions removes the options for good along with their stock
+func (r *GormRepository) purgeOptions(tx *gorm.DB, ids []string) error {
+	owned := r.quote("OptionId") + " IN (?)"
+	if err := tx.Where(owned, ids).Delete(&model.Stock{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where(owned, ids).Delete(&model.StockReservation{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Unscoped().Where(r.quote("Id")+" IN (?)", ids).Delete(&model.ProductOption{}).Error
+}
+
+func (r *MemoryRepository) ListDeletedProducts(page model.Page) ([]model.Product, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deleted := make([]model.Product, 0, len(r.deletedProducts))
+	for _, p := range r.deletedProducts {
+		p.Prices = copyPrices(p.ID, p.Prices)
+		deleted = append(deleted, p)
+	}
+	sort.Slice(deleted, func(i, j int) bool {
+		if !deleted[i].DeletedAt.Equal(*deleted[j].DeletedAt) {
+			return deleted[i].DeletedAt.After(*deleted[j].DeletedAt)
+		}
+		return deleted[i].ID < deleted[j].ID
+	})
+
+	products := []model.Product{}
+	for i := page.Offset; i < len(deleted) && (page.Limit <= 0 || len(products) < page.Limit); i++ {
+		products = append(products, deleted[i])
+	}
+
+	return products, len(deleted), nil
+}
+
+func (r *MemoryRepository) RestoreProduct(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.deletedProducts[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	deletedAt := *product.DeletedAt
+	product.DeletedAt = nil
+	r.products[id] = product
+	r.productOrder = append(r.productOrder, id)
+	delete(r.deletedProducts, id)
+
+	// Options deleted on their own before stay in the trash
+	for _, option := range r.deletedOptions {
+		if option.ProductID == id && option.DeletedAt.Equal(deletedAt) {
+			r.restoreOption(option)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ListDeletedOptions(productID string) ([]model.ProductOption, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	options := []model.ProductOption{}
+	for _, o := range r.deletedOptions {
+		if o.ProductID == productID {
+			options = append(options, o)
+		}
+	}
+	sort.Slice(options, func(i, j int) bool {
+		if !options[i].DeletedAt.Equal(*options[j].DeletedAt) {
+			return options[i].DeletedAt.After(*options[j].DeletedAt)
+		}
+		return options[i].ID < options[j].ID
+	})
+
+	return options, nil
+}
+
+func (r *MemoryRepository) RestoreOption(productID string, optionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	option, ok := r.deletedOptions[optionID]
+	if !ok || option.ProductID != productID {
+		return ErrNotFound
+	}
+	r.restoreOption(option)
+
+	return nil
+}
+
+func (r *MemoryRepository) PurgeProduct(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.deletedProducts[id]; !ok {
+		return ErrNotFound
+	}
+	r.purgeProduct(id)
+
+	return nil
+}
+
+func (r *MemoryRepository) Purge(before time.Time) (model.PurgeResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := model.PurgeResult{Before: before}
+	for id, p := range r.deletedProducts {
+		if p.DeletedAt.Before(before) {
+			r.purgeProduct(id)
+			result.Products++
+		}
+	}
+	for id, o := range r.deletedOptions {
+		if o.DeletedAt.Before(before) {
+			r.purgeOption(id)
+			result.Options++
+		}
+	}
+
+	return result, nil
+}
+
+// restoreOption moves an option out of the trash
+// Needs the lock to be held
+func (r *MemoryRepository) restoreOption(option model.ProductOption) {
+	delete(r.deletedOptions, option.ID)
+	option.DeletedAt = nil
+	r.options[option.ID] = option
+	r.optionOrder = append(r.optionOrder, option.ID)
+}
+
+// purgeProduct removes a deleted product for good along with everything belonging to it,
+// keeping the stock ledger
+// Needs the lock to be held
+func (r *MemoryRepository) purgeProduct(id string) {
+	delete(r.deletedProducts, id)
+	for optionID, option := range r.deletedOptions {
+		if option.ProductID == id {
+			r.purgeOption(optionID)
+		}
+	}
+	for variantID, variant := range r.variants {
+		if variant.ProductID == id {
+			delete(r.variants, variantID)
+		}
+	}
+	for key, level := range r.stock {
+		if level.ProductID == id {
+			delete(r.stock, key)
+		}
+	}
+	for reservationID, reservation := range r.reservations {
+		if reservation.ProductID == id {
+			delete(r.reservations, reservationID)
+		}
+	}
+}
+
+// purgeOption removes a deleted option for good along with its stock
+// Needs the lock to be held
+func (r *MemoryRepository) purgeOption(id string) {
+	option := r.deletedOptions[id]
+	delete(r.deletedOptions, id)
+	delete(r.stock, stockKey(option.ProductID, id))
+	for reservationID, reservation := range r.reservations {
+		if reservation.OptionID == id {
+			delete(r.reservations, reservationID)
+		}
+	}
+}
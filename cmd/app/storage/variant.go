@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"../model"
+	"sort"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Product variant storage
+// Both backends keep variants in their own table or map, with the SKU unique
+// across all products and one variant per combination of options
+
+func (r *GormRepository) ListVariants(productID string) ([]model.ProductVariant, error) {
+	var variants []model.ProductVariant
+
+	err := r.db.Where(r.quote("ProductId")+" = ?", productID).
+		Order(r.quote("Sku")).
+		Find(&variants).Error
+
+	return variants, err
+}
+
+func (r *GormRepository) GetVariant(productID string, variantID string) (*model.ProductVariant, error) {
+	var variant model.ProductVariant
+
+	err := r.db.Where(r.quote("ProductId")+" = ? AND "+r.quote("Id")+" = ?", productID, variantID).
+		Find(&variant).Error
+
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &variant, nil
+}
+
+func (r *GormRepository) CreateVariants(variants []model.ProductVariant) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return r.createVariants(tx, variants)
+	})
+}
+
+func (r *GormRepository) GenerateVariants(productID string, disable []string, variants []model.ProductVariant) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if len(disable) > 0 {
+			err := tx.Model(&model.ProductVariant{}).
+				Where(r.quote("ProductId")+" = ? AND "+r.quote("Id")+" IN (?)", productID, disable).
+				UpdateColumn("Enabled", false).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return r.createVariants(tx, variants)
+	})
+}
+
+func (r *GormRepository) UpdateVariant(productID string, variantID string, variant *model.ProductVariant) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := r.checkSku(tx, variant.Sku, variantID); err != nil {
+			return err
+		}
+
+		// A map writes the enabled flag and the price even when they are zero
+		res := tx.Model(&model.ProductVariant{}).
+			Where(r.quote("Id")+" = ? AND "+r.quote("ProductId")+" = ?", variantID, productID).
+			Updates(map[string]interface{}{"Sku": variant.Sku, "Price": variant.Price, "Enabled": variant.Enabled})
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+}
+
+func (r *GormRepository) DeleteVariant(productID string, variantID string) error {
+	res := r.db.Where(r.quote("ProductId")+" = ?", productID).
+		Delete(&model.ProductVariant{ID: variantID})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// createVariants stores the variants within the transaction
+func (r *GormRepository) createVariants(tx *gorm.DB, variants []model.ProductVariant) error {
+	for i := range variants {
+		if err := r.checkSku(tx, variants[i].Sku, variants[i].ID); err != nil {
+			return err
+		}
+		if err := tx.Create(&variants[i]).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkSku returns ErrDuplicate when another variant already uses the SKU
+func (r *GormRepository) checkSku(tx *gorm.DB, sku string, variantID string) error {
+	var count int
+	err := tx.Model(&model.ProductVariant{}).
+		Where(r.quote("Sku")+" = ? AND "+r.quote("Id")+" <> ?", sku, variantID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return ErrDuplicate
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ListVariants(productID string) ([]model.ProductVariant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	variants := []model.ProductVariant{}
+	for _, v := range r.variants {
+		if v.ProductID == productID {
+			v.OptionIDs = append(model.IDList(nil), v.OptionIDs...)
+			variants = append(variants, v)
+		}
+	}
+	sort.Slice(variants, func(i, j int) bool { return variants[i].Sku < variants[j].Sku })
+
+	return variants, nil
+}
+
+func (r *MemoryRepository) GetVariant(productID string, variantID string) (*model.ProductVariant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	variant, ok := r.variants[variantID]
+	if !ok || variant.ProductID != productID {
+		return nil, nil
+	}
+	variant.OptionIDs = append(model.IDList(nil), variant.OptionIDs...)
+
+	return &variant, nil
+}
+
+func (r *MemoryRepository) CreateVariants(variants []model.ProductVariant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkVariants(variants); err != nil {
+		return err
+	}
+	r.storeVariants(variants)
+
+	return nil
+}
+
+func (r *MemoryRepository) GenerateVariants(productID string, disable []string, variants []model.ProductVariant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkVariants(variants); err != nil {
+		return err
+	}
+
+	for _, id := range disable {
+		if v, ok := r.variants[id]; ok && v.ProductID == productID {
+			v.Enabled = false
+			r.variants[id] = v
+		}
+	}
+	r.storeVariants(variants)
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateVariant(productID string, variantID string, variant *model.ProductVariant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.variants[variantID]
+	if !ok || stored.ProductID != productID {
+		return ErrNotFound
+	}
+	if r.skuTaken(variant.Sku, variantID) {
+		return ErrDuplicate
+	}
+
+	stored.Sku = variant.Sku
+	stored.Price = variant.Price
+	stored.Enabled = variant.Enabled
+	r.variants[variantID] = stored
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteVariant(productID string, variantID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	variant, ok := r.variants[variantID]
+	if !ok || variant.ProductID != productID {
+		return ErrNotFound
+	}
+
+	delete(r.variants, variantID)
+
+	return nil
+}
+
+// checkVariants checks a whole batch first so nothing is stored when one fails
+// Needs the lock to be held
+func (r *MemoryRepository) checkVariants(variants []model.ProductVariant) error {
+	skus := make(map[string]bool, len(variants))
+	for _, v := range variants {
+		if _, ok := r.variants[v.ID]; ok || skus[v.Sku] || r.skuTaken(v.Sku, v.ID) {
+			return ErrDuplicate
+		}
+		skus[v.Sku] = true
+	}
+
+	return nil
+}
+
+// storeVariants keeps copies of the variants
+// Needs the lock to be held
+func (r *MemoryRepository) storeVariants(variants []model.ProductVariant) {
+	for _, v := range variants {
+		v.OptionIDs = append(model.IDList(nil), v.OptionIDs...)
+		r.variants[v.ID] = v
+	}
+}
+
+// skuTaken reports whether a variant other than the given one uses the SKU
+// Needs the lock to be held
+func (r *MemoryRepository) skuTaken(sku string, variantID string) bool {
+	for id, v := range r.variants {
+		if v.Sku == sku && id != variantID {
+			return true
+		}
+	}
+
+	return false
+}
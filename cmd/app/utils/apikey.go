@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// API keys
+// A key is the ID of its record and a random secret joined by a dot, so the
+// record is found without scanning, and only the SHA-256 hash of the secret is stored
+// The secrets are random enough for a fast hash to be safe
+
+// HeaderAPIKey carries the API key of a request
+const HeaderAPIKey = "X-API-Key"
+
+// GenerateAPIKey returns a new key for the record ID along with the hash of its secret to store
+func GenerateAPIKey(id string) (key string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	return id + "." + secret, hashSecret(secret), nil
+}
+
+// SplitAPIKey returns the record ID of a key and the hash of its secret
+func SplitAPIKey(key string) (id string, hash string, ok bool) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+
+	return parts[0], hashSecret(parts[1]), true
+}
+
+// MatchAPIKeyHash compares two hashes in constant time
+func MatchAPIKeyHash(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// hashSecret returns the hex encoded SHA-256 hash of a secret
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,37 +1,181 @@
 package utils
 
 import (
+	"net/http"
+
 	"github.com/labstack/echo"
 )
 
 // Error construction kit to help with the error formatting and response
+// Every failure is described by an Error carrying a stable machine readable code
+// and its HTTP status, and is rendered as an RFC 7807 problem document
+
+// Stable error codes
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodePrecondition     = "precondition_failed"
+	CodeNoPrecondition   = "precondition_required"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeInternal         = "internal_error"
+)
 
+// ProblemType prefixes the code to build the problem type URI
+const ProblemType = "urn:product:problem:"
+
+// MIMEProblemJSON is the content type of problem documents
+const MIMEProblemJSON = "application/problem+json"
+
+// Error is a failure which knows how it is reported to the client
 type Error struct {
-	Errors map[string]interface{} `json:"errors"`
+	Code    string
+	Status  int
+	Message string
+	Fields  []Violation
+
+	// Err is the underlying cause, it is logged but never shown to the client
+	Err error
 }
 
-func NewError(err error) Error {
-	e := Error{}
-	e.Errors = make(map[string]interface{})
-	switch v := err.(type) {
-	case *echo.HTTPError:
-		e.Errors["body"] = v.Message
-	default:
-		e.Errors["body"] = v.Error()
+// Error returns the message of the error
+func (e *Error) Error() string {
+	if e.Err != nil && e.Message == "" {
+		return e.Err.Error()
+	}
+
+	return e.Message
+}
+
+// Problem is the RFC 7807 document describing an error
+type Problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Code     string      `json:"code"`
+	Errors   []Violation `json:"errors,omitempty"`
+}
+
+// Problem describes the error for the given request path
+func (e *Error) Problem(instance string) Problem {
+	return Problem{
+		Type:     ProblemType + e.Code,
+		Title:    http.StatusText(e.Status),
+		Status:   e.Status,
+		Detail:   e.Message,
+		Instance: instance,
+		Code:     e.Code,
+		Errors:   e.Fields,
 	}
-	return e
 }
 
-func AccessForbidden() Error {
-	e := Error{}
-	e.Errors = make(map[string]interface{})
-	e.Errors["body"] = "access forbidden"
-	return e
+// InvalidRequest reports a malformed request, like a bad query parameter
+func InvalidRequest(message string) *Error {
+	return &Error{Code: CodeInvalidRequest, Status: http.StatusBadRequest, Message: message}
+}
+
+// InvalidID reports a path parameter which is not a valid UUID
+func InvalidID() *Error {
+	return InvalidRequest("Invalid UUID")
 }
 
-func NotFound() Error {
-	e := Error{}
-	e.Errors = make(map[string]interface{})
-	e.Errors["body"] = "resource not found"
-	return e
+// Validation reports a payload breaking validation rules
+func Validation(violations []Violation) *Error {
+	return &Error{Code: CodeValidation, Status: http.StatusUnprocessableEntity, Message: ValidationErrors(violations).Error(), Fields: violations}
+}
+
+// Unauthorized reports a request without valid credentials
+func Unauthorized(message string) *Error {
+	return &Error{Code: CodeUnauthorized, Status: http.StatusUnauthorized, Message: message}
+}
+
+// AccessForbidden reports a caller lacking the permission for a request
+func AccessForbidden() *Error {
+	return &Error{Code: CodeForbidden, Status: http.StatusForbidden, Message: "access forbidden"}
+}
+
+// NotFound reports a missing resource
+func NotFound() *Error {
+	return &Error{Code: CodeNotFound, Status: http.StatusNotFound, Message: "resource not found"}
+}
+
+// NotFoundError reports a missing resource, explaining what is missing
+func NotFoundError(message string) *Error {
+	return &Error{Code: CodeNotFound, Status: http.StatusNotFound, Message: message}
+}
+
+// Conflict reports a request clashing with the current state of a resource
+func Conflict(message string) *Error {
+	return &Error{Code: CodeConflict, Status: http.StatusConflict, Message: message}
+}
+
+// PreconditionFailed reports a conditional request whose condition does not hold,
+// like an If-Match naming a version which is no longer the current one
+func PreconditionFailed(message string) *Error {
+	return &Error{Code: CodePrecondition, Status: http.StatusPreconditionFailed, Message: message}
+}
+
+// PreconditionRequired reports a write which has to be made conditional
+func PreconditionRequired(message string) *Error {
+	return &Error{Code: CodeNoPrecondition, Status: http.StatusPreconditionRequired, Message: message}
+}
+
+// TooManyRequests reports a client which ran out of its request quota
+func TooManyRequests(message string) *Error {
+	return &Error{Code: CodeTooManyRequests, Status: http.StatusTooManyRequests, Message: message}
+}
+
+// Internal wraps an unexpected failure, its details stay in the logs
+func Internal(err error) *Error {
+	return &Error{Code: CodeInternal, Status: http.StatusInternalServerError, Message: "internal server error", Err: err}
+}
+
+// statusCodes maps the statuses raised by the framework to error codes
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeInvalidRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusPreconditionFailed:    CodePrecondition,
+	http.StatusPreconditionRequired:  CodeNoPrecondition,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+	http.StatusUnprocessableEntity:   CodeValidation,
+	http.StatusTooManyRequests:       CodeTooManyRequests,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusRequestEntityTooLarge: CodeInvalidRequest,
+}
+
+// NewError turns any error into an Error
+// Framework errors keep their status, anything unknown is internal
+func NewError(err error) *Error {
+	switch v := err.(type) {
+	case *Error:
+		return v
+	case ValidationErrors:
+		return Validation(v)
+	case *echo.HTTPError:
+		code, ok := statusCodes[v.Code]
+		if !ok {
+			code = CodeInternal
+			if v.Code < http.StatusInternalServerError {
+				code = CodeInvalidRequest
+			}
+		}
+		message, _ := v.Message.(string)
+		if message == "" {
+			message = http.StatusText(v.Code)
+		}
+		return &Error{Code: code, Status: v.Code, Message: message, Err: v.Internal}
+	default:
+		return Internal(err)
+	}
 }
@@ -1,19 +1,360 @@
 package utils
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 	"time"
+
+	"github.com/dgrijalva/jwt-go"
 )
 
 // API Security
+// Callers present a bearer JWT naming them in sub and listing what they may
+// do in scope, either a space separated string or an array of strings
+// Tokens name the key they are signed with in kid, so keys can be rotated:
+// new tokens are signed with the current key while older keys keep verifying
+// the tokens they signed until they are retired
+// The role and team claims say what the caller may change, callers without a
+// role are viewers
+
+// Scopes granted by tokens
+const (
+	ScopeRead  = "products:read"
+	ScopeWrite = "products:write"
+)
+
+// Scopes holds every scope
+var Scopes = []string{ScopeRead, ScopeWrite}
+
+// IsScope reports whether the name is one of the scopes
+func IsScope(name string) bool {
+	for _, s := range Scopes {
+		if s == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Roles of callers
+// Viewers only read, editors change the products of their team and admins change every product
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Roles holds every role, from the least to the most privileged
+var Roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+// IsRole reports whether the name is one of the roles
+func IsRole(name string) bool {
+	for _, r := range Roles {
+		if r == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PrincipalKey names the authenticated caller on the request context
+const PrincipalKey = "principal"
+
+// Signing algorithms of the keys
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject string
+	Scopes  []string
+	Role    string
+	Team    string
+}
+
+// HasScope reports whether the caller was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JWTKey is one key of a keyring
+// HS256 keys sign and verify with their secret, RS256 and ES256 keys sign with
+// their private half and verify with the public one, which may be given alone
+type JWTKey struct {
+	ID        string
+	Algorithm string
+
+	// RetireAt is when tokens signed with the key stop being accepted, zero for never
+	RetireAt time.Time
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewJWTKey builds a key from its secret or its PEM encoded private or public key
+func NewJWTKey(id string, algorithm string, secret []byte, privateKey []byte, publicKey []byte) (*JWTKey, error) {
+	key := &JWTKey{ID: id, Algorithm: algorithm}
+
+	switch algorithm {
+	case AlgorithmHS256:
+		if len(secret) == 0 {
+			return nil, errors.New("HS256 needs a secret")
+		}
+		key.signKey, key.verifyKey = secret, secret
+
+	case AlgorithmRS256:
+		if privateKey != nil {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(privateKey)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey, key.verifyKey = private, &private.PublicKey
+		}
+		if publicKey != nil {
+			public, err := jwt.ParseRSAPublicKeyFromPEM(publicKey)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		}
+
+	case AlgorithmES256:
+		if privateKey != nil {
+			private, err := jwt.ParseECPrivateKeyFromPEM(privateKey)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey, key.verifyKey = private, &private.PublicKey
+		}
+		if publicKey != nil {
+			public, err := jwt.ParseECPublicKeyFromPEM(publicKey)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		}
+		if public, ok := key.verifyKey.(*ecdsa.PublicKey); ok && public.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 needs a P-256 key")
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown algorithm %q", algorithm)
+	}
+
+	if key.verifyKey == nil {
+		return nil, errors.New(algorithm + " needs a private or a public key")
+	}
+
+	return key, nil
+}
+
+// retired reports whether tokens signed with the key are no longer accepted
+func (k *JWTKey) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// Keyring holds the keys tokens are verified with and the current one new tokens are signed with
+type Keyring struct {
+	keys    map[string]*JWTKey
+	list    []*JWTKey
+	current *JWTKey
+}
+
+// NewKeyring collects the keys, the current key being the named one or else the first one not retired
+// Tokens without a kid are taken to be signed with the current key
+func NewKeyring(current string, keys ...*JWTKey) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]*JWTKey, len(keys)), list: keys}
+	for _, key := range keys {
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("key %q is given more than once", key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+
+	if current != "" {
+		if k.current = k.keys[current]; k.current == nil {
+			return nil, fmt.Errorf("there is no key %q to sign with", current)
+		}
+		return k, nil
+	}
+	for _, key := range keys {
+		if !key.retired(time.Now()) {
+			k.current = key
+			break
+		}
+	}
+
+	return k, nil
+}
+
+// Verify returns the caller a token names, tokens have to carry a subject and an expiry
+// The token has to be signed with the algorithm of the key its kid names, and the key must not be retired
+func (k *Keyring) Verify(token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		key := k.current
+		if kid, ok := t.Header["kid"]; ok {
+			id, _ := kid.(string)
+			key = k.keys[id]
+		}
+		if key == nil {
+			return nil, errors.New("token is signed with an unknown key")
+		}
+		if key.retired(time.Now()) {
+			return nil, fmt.Errorf("key %s is retired", key.ID)
+		}
+		if t.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("key %s only verifies %s tokens", key.ID, key.Algorithm)
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = RoleViewer
+	}
+	if !IsRole(role) {
+		return nil, fmt.Errorf("token names the unknown role %q", role)
+	}
+	team, _ := claims["team"].(string)
+
+	return &Principal{Subject: subject, Scopes: scopes(claims["scope"]), Role: role, Team: team}, nil
+}
+
+// scopes reads the scope claim, written as a space separated string or an array
+func scopes(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return strings.Fields(c)
+	case []interface{}:
+		var list []string
+		for _, s := range c {
+			if scope, ok := s.(string); ok {
+				list = append(list, scope)
+			}
+		}
+		return list
+	}
+
+	return nil
+}
+
+// GenerateJWT issues a token for the caller with its scopes, role and team, valid for the ttl
+// and signed with the current key
+func (k *Keyring) GenerateJWT(principal Principal, ttl time.Duration) (string, error) {
+	if principal.Subject == "" {
+		return "", errors.New("a token needs a subject")
+	}
+	if ttl <= 0 {
+		return "", errors.New("a token needs a positive lifetime")
+	}
+	if principal.Role != "" && !IsRole(principal.Role) {
+		return "", fmt.Errorf("unknown role %q", principal.Role)
+	}
+
+	key := k.current
+	if key == nil {
+		return "", errors.New("there is no key to sign with")
+	}
+	if key.signKey == nil {
+		return "", fmt.Errorf("key %s has no private key to sign with", key.ID)
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), jwt.MapClaims{
+		"sub":   principal.Subject,
+		"scope": strings.Join(principal.Scopes, " "),
+		"role":  principal.Role,
+		"iat":   now.Unix(),
+		"exp":   now.Add(ttl).Unix(),
+	})
+	if principal.Team != "" {
+		token.Claims.(jwt.MapClaims)["team"] = principal.Team
+	}
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.signKey)
+}
+
+// JSONWebKey is the public half of a key as published in a JWK set
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC curve and point
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the RFC 7517 document listing the public keys
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS lists the public keys which verify tokens, shared secrets are never published
+func (k *Keyring) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	encode := base64.RawURLEncoding.EncodeToString
+
+	for _, key := range k.list {
+		if key.retired(time.Now()) {
+			continue
+		}
+
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JSONWebKey{KeyType: "RSA", ID: key.ID, Algorithm: key.Algorithm, Use: "sig",
+				N: encode(public.N.Bytes()), E: encode(big.NewInt(int64(public.E)).Bytes())})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, JSONWebKey{KeyType: "EC", ID: key.ID, Algorithm: key.Algorithm, Use: "sig",
+				Curve: "P-256", X: encode(padded(public.X, 32)), Y: encode(padded(public.Y, 32))})
+		}
+	}
+
+	return set
+}
 
-var JWTSecret = []byte("!!SECRET!!")
+// padded returns the big endian bytes of the number, left padded to the size
+func padded(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
 
-func GenerateJWT(id uint) string {
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["id"] = id
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
-	t, _ := token.SignedString(JWTSecret)
-	return t
+	return append(make([]byte, size-len(b)), b...)
 }
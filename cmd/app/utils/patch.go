@@ -0,0 +1,376 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSON patch kit
+// Applies RFC 7396 merge patches and RFC 6902 JSON patches to JSON documents
+// Numbers are kept as written so amounts never go through a float
+
+// Media types of the patch documents
+const (
+	MIMEMergePatch = "application/merge-patch+json"
+	MIMEJSONPatch  = "application/json-patch+json"
+)
+
+// MergePatch applies a JSON merge patch to the document
+// Members set to null in the patch are removed, objects are merged and anything else replaces the target
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	target, err := decodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decodeJSON(patch)
+	if err != nil {
+		return nil, InvalidRequest("the merge patch is not valid JSON")
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+// mergeValue merges the patch into the target following RFC 7396
+func mergeValue(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergeValue(t[key], value)
+	}
+
+	return t
+}
+
+// patchOperation is one step of a JSON patch
+// A missing value stays nil while an explicit null is kept as written
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONPatch applies a JSON patch to the document, all of its operations or none of them
+// A malformed patch is an invalid request, a patch which does not fit the document a conflict
+func JSONPatch(doc []byte, patch []byte) ([]byte, error) {
+	target, err := decodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []patchOperation
+	if err = json.Unmarshal(patch, &operations); err != nil {
+		return nil, InvalidRequest("the JSON patch has to be an array of operations")
+	}
+
+	for i, op := range operations {
+		if target, err = applyOperation(target, op); err != nil {
+			if e, ok := err.(*Error); ok {
+				e.Message = "operation " + strconv.Itoa(i) + ": " + e.Message
+			}
+			return nil, err
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+// applyOperation runs one operation against the document and returns the new document
+func applyOperation(doc interface{}, op patchOperation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, InvalidRequest("path is required")
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, InvalidRequest(op.Op + " needs a value")
+		}
+		if value, err = decodeJSON(op.Value); err != nil {
+			return nil, InvalidRequest("value is not valid JSON")
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, InvalidRequest(op.Op + " needs a from")
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = getPointer(doc, from); err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(*op.Path+"/", *op.From+"/") && *op.Path != *op.From {
+				return nil, InvalidRequest("cannot move a value into itself")
+			}
+			if doc, err = updatePointer(doc, from, removeMember); err != nil {
+				return nil, err
+			}
+		}
+		if op.Op == "copy" {
+			// Copy through JSON so the two places never share a value
+			raw, _ := json.Marshal(value)
+			value, _ = decodeJSON(raw)
+		}
+	case "remove":
+	default:
+		return nil, InvalidRequest("unknown operation " + strconv.Quote(op.Op))
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		if len(path) == 0 {
+			return value, nil
+		}
+		return updatePointer(doc, path, addMember(value))
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		return updatePointer(doc, path, replaceMember(value))
+	case "remove":
+		if len(path) == 0 {
+			return nil, InvalidRequest("cannot remove the whole document")
+		}
+		return updatePointer(doc, path, removeMember)
+	}
+
+	// Test
+	current, err := getPointer(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	if !equalJSON(current, value) {
+		return nil, Conflict("test failed at " + *op.Path)
+	}
+
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, InvalidRequest("path " + strconv.Quote(pointer) + " has to start with /")
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+// getPointer returns the value the tokens lead to
+func getPointer(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		var err error
+		if doc, err = member(doc, token); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// memberUpdate changes the member named by the key of a container and returns the new container
+type memberUpdate func(container interface{}, key string) (interface{}, error)
+
+// updatePointer applies the update to the parent of the value the tokens lead to
+func updatePointer(doc interface{}, tokens []string, update memberUpdate) (interface{}, error) {
+	if len(tokens) == 1 {
+		return update(doc, tokens[0])
+	}
+
+	child, err := member(doc, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = updatePointer(child, tokens[1:], update); err != nil {
+		return nil, err
+	}
+
+	return replaceMember(child)(doc, tokens[0])
+}
+
+// member returns the named member of an object or element of an array
+func member(container interface{}, key string) (interface{}, error) {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		value, ok := c[key]
+		if !ok {
+			return nil, Conflict("there is no member " + strconv.Quote(key))
+		}
+		return value, nil
+	case []interface{}:
+		i, err := arrayIndex(c, key, false)
+		if err != nil {
+			return nil, err
+		}
+		return c[i], nil
+	}
+
+	return nil, Conflict("cannot look into a value at " + strconv.Quote(key))
+}
+
+// addMember sets a member of an object or inserts an element into an array
+func addMember(value interface{}) memberUpdate {
+	return func(container interface{}, key string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[key] = value
+			return c, nil
+		case []interface{}:
+			i, err := arrayIndex(c, key, true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+
+		return nil, Conflict("cannot add to a value at " + strconv.Quote(key))
+	}
+}
+
+// replaceMember swaps an existing member of an object or element of an array
+func replaceMember(value interface{}) memberUpdate {
+	return func(container interface{}, key string) (interface{}, error) {
+		if _, err := member(container, key); err != nil {
+			return nil, err
+		}
+
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[key] = value
+			return c, nil
+		case []interface{}:
+			i, _ := arrayIndex(c, key, false)
+			c[i] = value
+			return c, nil
+		}
+
+		return nil, Conflict("cannot replace in a value at " + strconv.Quote(key))
+	}
+}
+
+// removeMember drops an existing member of an object or element of an array
+func removeMember(container interface{}, key string) (interface{}, error) {
+	if _, err := member(container, key); err != nil {
+		return nil, err
+	}
+
+	switch c := container.(type) {
+	case map[string]interface{}:
+		delete(c, key)
+		return c, nil
+	case []interface{}:
+		i, _ := arrayIndex(c, key, false)
+		return append(c[:i], c[i+1:]...), nil
+	}
+
+	return nil, Conflict("cannot remove from a value at " + strconv.Quote(key))
+}
+
+// arrayIndex reads an array index, - standing for the end of the array when adding
+func arrayIndex(array []interface{}, key string, adding bool) (int, error) {
+	if adding && key == "-" {
+		return len(array), nil
+	}
+
+	i, err := strconv.Atoi(key)
+	if err != nil || i < 0 || (key != "0" && strings.HasPrefix(key, "0")) {
+		return 0, InvalidRequest(strconv.Quote(key) + " is not an array index")
+	}
+
+	last := len(array) - 1
+	if adding {
+		last = len(array)
+	}
+	if i > last {
+		return 0, Conflict("index " + key + " is out of range")
+	}
+
+	return i, nil
+}
+
+// decodeJSON reads a JSON value, keeping numbers as written
+func decodeJSON(data []byte) (interface{}, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+
+	return value, nil
+}
+
+// equalJSON compares two JSON values, numbers by their value rather than their spelling
+func equalJSON(a interface{}, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !equalJSON(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSON(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
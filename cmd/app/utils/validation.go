@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validation construction kit
+// A validator runs every check against a payload and collects the violations
+// instead of stopping at the first one, so a client can fix all problems at once
+
+// Rule codes reported with violations
+const (
+	RuleRequired  = "required"
+	RuleLength    = "length"
+	RuleForbidden = "forbidden"
+	RuleUUID      = "uuid"
+	RuleDecimal   = "decimal"
+	RuleRange     = "range"
+	RuleCurrency  = "currency"
+	RuleUnique    = "unique"
+	RuleChoice    = "choice"
+	RuleFormat    = "format"
+)
+
+// Violation describes one broken rule of a field
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors holds every violation found in a payload
+type ValidationErrors []Violation
+
+// Error joins the messages of the violations
+func (v ValidationErrors) Error() string {
+	messages := make([]string, 0, len(v))
+	for _, violation := range v {
+		messages = append(messages, violation.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Validator collects violations
+type Validator struct {
+	violations ValidationErrors
+}
+
+// NewValidator returns a validator without any violations
+func NewValidator() *Validator {
+	return &Validator{}
+}
+
+// Add records a violation
+func (v *Validator) Add(field string, rule string, message string) {
+	v.violations = append(v.violations, Violation{Field: field, Rule: rule, Message: message})
+}
+
+// Check records a violation when the condition does not hold
+func (v *Validator) Check(ok bool, field string, rule string, message string) {
+	if !ok {
+		v.Add(field, rule, message)
+	}
+}
+
+// Absent requires a value not to be supplied
+func (v *Validator) Absent(field string, value string, message string) {
+	v.Check(value == "", field, RuleForbidden, message)
+}
+
+// Required requires a value to be supplied
+func (v *Validator) Required(field string, value string) bool {
+	v.Check(value != "", field, RuleRequired, field+" is required")
+	return value != ""
+}
+
+// Length requires the number of characters to be within the bounds
+func (v *Validator) Length(field string, value string, min int, max int) {
+	n := utf8.RuneCountInString(value)
+	if n < min || n > max {
+		if min > 0 {
+			v.Add(field, RuleLength, fmt.Sprintf("%s length should be between %d-%d characters", field, min, max))
+		} else {
+			v.Add(field, RuleLength, fmt.Sprintf("%s may be at most %d characters", field, max))
+		}
+	}
+}
+
+// UUID requires the value to be a valid UUID
+func (v *Validator) UUID(field string, value string) {
+	v.Check(IsValidUUID(value), field, RuleUUID, field+" is not a valid UUID")
+}
+
+// Err returns the collected violations, nil when there are none
+func (v *Validator) Err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+
+	return v.violations
+}
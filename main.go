@@ -1,29 +1,130 @@
 package main
 
 import (
+	"./cmd/app/command"
+	"./cmd/app/config"
 	"./cmd/app/controller"
 	"./cmd/app/handler"
+	"./cmd/app/ratelimit"
 	"./cmd/app/router"
 	"./cmd/app/storage"
+	"errors"
+	"fmt"
+	"os"
 )
 
 func main() {
 
-	// Instantiate the HTTP Framework to manage service
-	r := router.New()
+	// Resolve the configuration from defaults, config file, environment and flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	// Group the service name
-	v1 := r.Group("/products")
+	// Run a command instead of the service when one is given
+	if len(args) > 0 {
+		if err = run(cfg, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Instantiate a new storage to be injected
-	db := storage.New()
+	repo, err := storage.Open(cfg.Storage.Backend, cfg.Storage.DSN, cfg.Storage.AutoMigrate, cfg.LogSQL())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Instantiate the HTTP Framework to manage service, verifying tokens with the configured key
+	// and API keys against the storage, and keeping the rate limit buckets in process
+	r, err := router.New(cfg, repo, ratelimit.NewMemoryStore())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if cfg.Auth.SecretGenerated && cfg.Auth.Enabled {
+		r.Logger.Warn("no JWT secret configured, using a random one for this run")
+	}
+	if !cfg.Auth.Enabled {
+		r.Logger.Warn("authentication is turned off, every request is let through")
+	}
+
+	// Group the service name
+	v1 := r.Group("/products")
 
 	// Instantiate the service controller
-	c := controller.NewProductController(db)
+	c := controller.NewProductController(repo, cfg.PricingModel())
+
+	// Empty the trash of expired products and options in the background
+	if cfg.Trash.PurgeInterval > 0 {
+		go c.PurgeEvery(cfg.Trash.PurgeInterval, cfg.Trash.Retention, r.Logger)
+	}
 
 	// Instantiate the web handler and inject necessary components
-	handler.NewHandler(c).Register(v1)
+	handler.NewHandler(c, handler.Options{RequireIfMatch: cfg.Server.RequireIfMatch}).Register(v1)
 
 	// Start the web server
-	r.Logger.Fatal(r.Start("127.0.0.1:8080"))
+	r.Logger.Fatal(r.Start(cfg.Server.Address))
+}
+
+// run dispatches the command line commands
+func run(cfg *config.Config, args []string) error {
+	switch args[0] {
+
+	// Print the effective configuration
+	case "config":
+		return cfg.Print(os.Stdout)
+
+	// Apply or roll back schema migrations
+	case "migrate":
+		db, err := storage.New(cfg.Storage.DSN, cfg.LogSQL())
+		if err != nil {
+			return err
+		}
+		return command.Migrate(storage.NewMigrator(db), args[1:], os.Stdout)
+
+	// Remove the expired trash for good
+	case "purge":
+		repo, err := storage.Open(cfg.Storage.Backend, cfg.Storage.DSN, cfg.Storage.AutoMigrate, cfg.LogSQL())
+		if err != nil {
+			return err
+		}
+		return command.Purge(repo, cfg.Trash.Retention, os.Stdout)
+
+	// Report or clean the rows left behind by missing products and options
+	case "orphans":
+		repo, err := storage.Open(cfg.Storage.Backend, cfg.Storage.DSN, cfg.Storage.AutoMigrate, cfg.LogSQL())
+		if err != nil {
+			return err
+		}
+		return command.Orphans(repo, args[1:], os.Stdout)
+
+	// Issue a token signed with the current key
+	case "token":
+		if cfg.Auth.SecretGenerated {
+			return errors.New("configure auth.jwtSecret or auth.keys first, a token signed with a random secret never verifies")
+		}
+		keyring, err := cfg.Keyring()
+		if err != nil {
+			return err
+		}
+		return command.Token(keyring, args[1:], os.Stdout)
+
+	// Create, list, disable and revoke API keys
+	case "apikeys":
+		if cfg.Storage.Backend == storage.BackendMemory {
+			return errors.New("configure the sql storage backend first, API keys kept in memory are gone once the command exits")
+		}
+		repo, err := storage.Open(cfg.Storage.Backend, cfg.Storage.DSN, cfg.Storage.AutoMigrate, cfg.LogSQL())
+		if err != nil {
+			return err
+		}
+		return command.APIKeys(repo, args[1:], os.Stdout)
+	}
+
+	return fmt.Errorf("unknown command %q, expected config, migrate, purge, orphans, token or apikeys", args[0])
 }